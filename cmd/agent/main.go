@@ -5,12 +5,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/DieOfCode/go-alert-service/internal/agent"
 	"github.com/DieOfCode/go-alert-service/internal/configuration"
+	"github.com/DieOfCode/go-alert-service/internal/pb"
+	"github.com/DieOfCode/go-alert-service/internal/spool"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -28,19 +33,56 @@ func main() {
 	defer stop()
 
 	a := agent.New(&logger, client, cfg)
+	if cfg.GRPCAddress != "" {
+		conn, err := grpc.Dial(cfg.GRPCAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("gRPC client initializing error")
+		}
+		defer conn.Close()
+		a.UseGRPC(pb.NewMetricsClient(conn))
+	}
+	if cfg.SpoolDir != "" {
+		s, err := spool.Open(&logger, cfg.SpoolDir, int64(cfg.SpoolMaxSize)<<20, time.Duration(cfg.SpoolMaxAge)*time.Second, cfg.Labels)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Spool initializing error")
+		}
+		a.UseSpool(s)
+	}
+
+	for _, name := range cfg.Collectors {
+		c, err := agent.NewCollector(name)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Collector initializing error")
+		}
+		interval := cfg.PollInterval
+		if v, ok := cfg.CollectorIntervals[name]; ok {
+			interval = v
+		}
+		if err := a.Register(c, time.Duration(interval)*time.Second); err != nil {
+			logger.Fatal().Err(err).Msg("Collector initializing error")
+		}
+	}
 
 	logger.Info().
 		Int("pollInterval", cfg.PollInterval).
 		Int("reportInterval", cfg.ReportInterval).
+		Strs("collectors", cfg.Collectors).
 		Msg("Started collecting metrics")
 
-	go a.CollectRuntimeMetrics(ctx, time.Duration(cfg.PollInterval))
-	go a.CollectGopsutilMetrics(ctx, time.Duration(cfg.PollInterval))
-	metricsChan := a.PrepareMetrics(ctx, time.Duration(cfg.ReportInterval))
+	go a.RunCollectors(ctx)
+	metricsChan := a.PrepareMetrics(ctx, time.Duration(cfg.ReportInterval)*time.Second)
+	var wg sync.WaitGroup
 	for i := 0; i < cfg.RateLimit; i++ {
-		go a.Retry(ctx, 3, func(ct context.Context) error {
-			return a.SendMetrics(ct, metricsChan)
-		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				a.Retry(ctx, 3, func(ct context.Context) error {
+					return a.SendMetrics(ct, metricsChan)
+				})
+			}
+		}()
 	}
+	wg.Wait()
 	logger.Info().Msg("Finished collecting metrics")
 }
@@ -0,0 +1,5 @@
+-- enum values can't be dropped, the summary type stays unused
+DELETE FROM rollups WHERE type = 'summary';
+DELETE FROM samples WHERE type = 'summary';
+DELETE FROM metrics WHERE type = 'summary';
+ALTER TABLE metrics DROP COLUMN IF EXISTS summary;
@@ -0,0 +1,5 @@
+-- enum values can't be dropped, the set type stays unused
+DELETE FROM rollups WHERE type = 'set';
+DELETE FROM samples WHERE type = 'set';
+DELETE FROM metrics WHERE type = 'set';
+ALTER TABLE metrics DROP COLUMN IF EXISTS hll;
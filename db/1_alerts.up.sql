@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS alerts (
+    rule_id VARCHAR PRIMARY KEY,
+    state VARCHAR NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    active_at TIMESTAMPTZ,
+    fired_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS rules (
+    id VARCHAR PRIMARY KEY,
+    name VARCHAR NOT NULL DEFAULT '',
+    type VARCHAR NOT NULL,
+    metric VARCHAR NOT NULL,
+    condition VARCHAR NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    for_seconds INTEGER NOT NULL DEFAULT 0,
+    hysteresis DOUBLE PRECISION NOT NULL DEFAULT 0,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE
+);
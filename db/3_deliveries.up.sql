@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS deliveries (
+    id VARCHAR PRIMARY KEY,
+    notifier VARCHAR NOT NULL,
+    notification JSONB NOT NULL,
+    status VARCHAR NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error VARCHAR NOT NULL DEFAULT '',
+    next_attempt TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS deliveries_status_idx ON deliveries (status, next_attempt);
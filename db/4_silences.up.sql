@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS silences (
+    id VARCHAR PRIMARY KEY,
+    metric VARCHAR NOT NULL DEFAULT '',
+    type VARCHAR NOT NULL DEFAULT '',
+    host VARCHAR NOT NULL DEFAULT '',
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    comment VARCHAR NOT NULL DEFAULT '',
+    created_by VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS alert_history;
+
+ALTER TABLE alerts
+    DROP COLUMN IF EXISTS acknowledged_by,
+    DROP COLUMN IF EXISTS acknowledged_at,
+    DROP COLUMN IF EXISTS notified_at;
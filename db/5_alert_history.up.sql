@@ -0,0 +1,19 @@
+ALTER TABLE alerts
+    ADD COLUMN IF NOT EXISTS acknowledged_by VARCHAR NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS notified_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS alert_history (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id VARCHAR NOT NULL,
+    kind VARCHAR NOT NULL,
+    state VARCHAR NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    actor VARCHAR NOT NULL DEFAULT '',
+    comment VARCHAR NOT NULL DEFAULT '',
+    notifier VARCHAR NOT NULL DEFAULT '',
+    time TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS alert_history_rule_time_idx ON alert_history (rule_id, time);
+CREATE INDEX IF NOT EXISTS alert_history_time_idx ON alert_history (time);
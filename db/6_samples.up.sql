@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS samples (
+    id VARCHAR NOT NULL,
+    type VARCHAR NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    value DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS samples_series_time_idx ON samples (type, id, time);
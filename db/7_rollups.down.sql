@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS samples_time_idx;
+DROP TABLE IF EXISTS rollups;
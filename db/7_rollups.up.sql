@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS rollups (
+    resolution INTEGER NOT NULL,
+    type VARCHAR NOT NULL,
+    id VARCHAR NOT NULL,
+    time TIMESTAMPTZ NOT NULL,
+    min DOUBLE PRECISION NOT NULL,
+    max DOUBLE PRECISION NOT NULL,
+    sum DOUBLE PRECISION NOT NULL,
+    count BIGINT NOT NULL,
+    last DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (resolution, type, id, time)
+);
+
+CREATE INDEX IF NOT EXISTS samples_time_idx ON samples (time);
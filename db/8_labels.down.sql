@@ -0,0 +1,16 @@
+ALTER TABLE rules DROP COLUMN IF EXISTS labels;
+
+DELETE FROM rollups WHERE labels <> '{}';
+ALTER TABLE rollups DROP CONSTRAINT IF EXISTS rollups_pkey;
+ALTER TABLE rollups DROP COLUMN IF EXISTS labels;
+ALTER TABLE rollups ADD PRIMARY KEY (resolution, type, id, time);
+
+DELETE FROM samples WHERE labels <> '{}';
+DROP INDEX IF EXISTS samples_series_time_idx;
+ALTER TABLE samples DROP COLUMN IF EXISTS labels;
+CREATE INDEX IF NOT EXISTS samples_series_time_idx ON samples (type, id, time);
+
+DELETE FROM metrics WHERE labels <> '{}';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_id_type_labels_key;
+ALTER TABLE metrics DROP COLUMN IF EXISTS labels;
+ALTER TABLE metrics ADD CONSTRAINT metrics_id_type_key UNIQUE (id, type);
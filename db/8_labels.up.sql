@@ -0,0 +1,13 @@
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_id_type_key;
+ALTER TABLE metrics ADD CONSTRAINT metrics_id_type_labels_key UNIQUE (id, type, labels);
+
+ALTER TABLE samples ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+DROP INDEX IF EXISTS samples_series_time_idx;
+CREATE INDEX IF NOT EXISTS samples_series_time_idx ON samples (type, id, labels, time);
+
+ALTER TABLE rollups ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE rollups DROP CONSTRAINT IF EXISTS rollups_pkey;
+ALTER TABLE rollups ADD PRIMARY KEY (resolution, type, id, labels, time);
+
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
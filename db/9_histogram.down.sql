@@ -0,0 +1,5 @@
+-- enum values can't be dropped, the histogram type stays unused
+DELETE FROM rollups WHERE type = 'histogram';
+DELETE FROM samples WHERE type = 'histogram';
+DELETE FROM metrics WHERE type = 'histogram';
+ALTER TABLE metrics DROP COLUMN IF EXISTS histogram;
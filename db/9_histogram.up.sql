@@ -0,0 +1,2 @@
+ALTER TYPE metric_type ADD VALUE IF NOT EXISTS 'histogram';
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS histogram JSONB;
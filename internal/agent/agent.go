@@ -10,19 +10,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
-	"reflect"
-	"runtime"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/DieOfCode/go-alert-service/internal/configuration"
 	m "github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/pb"
+	"github.com/DieOfCode/go-alert-service/internal/spool"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/rs/zerolog"
-	"github.com/shirou/gopsutil/mem"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type HTTPClient interface {
@@ -30,27 +29,29 @@ type HTTPClient interface {
 }
 
 type Agent struct {
-	mu      sync.Mutex
-	logger  *zerolog.Logger
-	client  HTTPClient
-	Metrics []m.AgentMetric
-	address string
-	key     string
-	counter *int64
-	gw      *gzip.Writer
+	mu       sync.Mutex
+	logger   *zerolog.Logger
+	client   HTTPClient
+	registry *Registry
+	address  string
+	key      string
+	gw       *gzip.Writer
+	// collectors are polled by RunCollectors
+	collectors []collector
+	// grpc replaces POST /updates/ when set
+	grpc pb.MetricsClient
+	// spool keeps the batches until they are sent when set
+	spool *spool.Spool
 }
 
 func New(logger *zerolog.Logger, client HTTPClient, config *configuration.Config) *Agent {
-	counter := new(int64)
-	*counter = 0
 	return &Agent{
-		logger:  logger,
-		client:  client,
-		address: config.ServerAddress,
-		counter: counter,
-		key:     config.Key,
-		gw:      gzip.NewWriter(io.Discard),
-		Metrics: make([]m.AgentMetric, len(m.GaugeMetrics)+5),
+		logger:   logger,
+		client:   client,
+		address:  config.ServerAddress,
+		key:      config.Key,
+		gw:       gzip.NewWriter(io.Discard),
+		registry: NewRegistry(config.Labels),
 	}
 }
 
@@ -101,6 +102,17 @@ func New(logger *zerolog.Logger, client HTTPClient, config *configuration.Config
 // 	return nil
 // }
 
+// UseGRPC makes the agent send the metrics with the UpdateMetrics RPC.
+func (a *Agent) UseGRPC(client pb.MetricsClient) {
+	a.grpc = client
+}
+
+// UseSpool makes the agent keep the batches in the spool until the server
+// accepts them.
+func (a *Agent) UseSpool(s *spool.Spool) {
+	a.spool = s
+}
+
 func (a *Agent) PrepareMetrics(ctx context.Context, interval time.Duration) <-chan []m.AgentMetric {
 	ch := make(chan []m.AgentMetric)
 	wg := &sync.WaitGroup{}
@@ -112,7 +124,16 @@ func (a *Agent) PrepareMetrics(ctx context.Context, interval time.Duration) <-ch
 		for {
 			select {
 			case <-poll.C:
-				ch <- a.Metrics
+				batch := a.registry.Snapshot()
+				if len(batch) == 0 {
+					continue
+				}
+				select {
+				case ch <- batch:
+				case <-ctx.Done():
+					poll.Stop()
+					return
+				}
 			case <-ctx.Done():
 				poll.Stop()
 				return
@@ -129,117 +150,54 @@ func (a *Agent) PrepareMetrics(ctx context.Context, interval time.Duration) <-ch
 }
 
 func (a *Agent) SendMetrics(ctx context.Context, metrics <-chan []m.AgentMetric) error {
+	if a.spool != nil {
+		return a.spoolMetrics(ctx, metrics)
+	}
 	for {
 		m, ok := <-metrics
 		if !ok {
 			return nil
 		} else {
-			b, err := json.Marshal(m)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("Marshalling error")
-				return err
-			}
-			a.logger.Info().Any("json", string(b)).Msg("Marshalled")
-			buf := &bytes.Buffer{}
-			a.gw.Reset(buf)
-			n, err := a.gw.Write(b)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("gw.Write error")
-				return err
-			}
-			a.gw.Close()
-			a.logger.Info().
-				Int("len of b", len(b)).
-				Int("written bytes", n).
-				Int("len of buf", len(buf.Bytes())).
-				Send()
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/updates/", a.address), buf)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("http.NewRequestWithContext method error")
-				return err
-			}
-			if a.key != "" {
-				buf2 := *buf
-				h := hmac.New(sha256.New, []byte(a.key))
-				if _, err := h.Write(buf2.Bytes()); err != nil {
-					return err
-				}
-				d := h.Sum(nil)
-				a.logger.Info().Msgf("hash: %x", d)
-				req.Header.Add("HashSHA256", hex.EncodeToString(d))
-			}
-			req.Header.Add("Content-Type", "application/json")
-			req.Header.Add("Content-Encoding", "gzip")
-			res, err := a.client.Do(req)
-			if err != nil {
-				a.logger.Error().Err(err).Msg("client.Do method error")
-				return err
-			}
-			res.Body.Close()
-			a.logger.Info().Any("metric", a.Metrics).Msg("Metrics are sent")
-			return nil
+			return a.send(ctx, m)
 		}
 	}
 }
 
-func (a *Agent) CollectRuntimeMetrics(ctx context.Context, interval time.Duration) {
-	poll := time.NewTicker(interval)
-
-	for {
-		select {
-		case <-poll.C:
-			atomic.AddInt64(a.counter, 1)
-			var memStats runtime.MemStats
-			runtime.ReadMemStats(&memStats)
-			msvalue := reflect.ValueOf(memStats)
-			mstype := msvalue.Type()
-
-			for _, metric := range m.GaugeMetrics {
-				field, ok := mstype.FieldByName(metric)
-				if !ok {
-					return
-				}
-				value := msvalue.FieldByName(metric).Interface()
-				a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeGauge, ID: field.Name, Value: value})
+// spoolMetrics appends every batch to the spool before it is sent, so the
+// batches the server doesn't accept are replayed in order with the next one.
+func (a *Agent) spoolMetrics(ctx context.Context, metrics <-chan []m.AgentMetric) error {
+	for batch := range metrics {
+		if err := a.spool.Append(batch); err != nil {
+			a.logger.Error().Err(err).Msg("Failed to spool metrics")
+			if err := a.send(ctx, batch); err != nil {
+				a.logger.Error().Err(err).Msg("Metrics are lost")
 			}
-
-			a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeGauge, ID: "RandomValue", Value: rand.Float64()})
-			a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeCounter, ID: "PollCount", Delta: *a.counter})
-		case <-ctx.Done():
-			poll.Stop()
-			return
+			continue
+		}
+		err := a.spool.Replay(func(batch []m.AgentMetric) error {
+			return a.send(ctx, batch)
+		})
+		if err != nil {
+			a.logger.Error().Err(err).Msg("Metrics are kept in the spool")
 		}
 	}
+	return nil
 }
 
-func (a *Agent) CollectGopsutilMetrics(ctx context.Context, interval time.Duration) {
-	poll := time.NewTicker(interval)
-
-	for {
-		select {
-		case <-poll.C:
-			v, err := mem.VirtualMemory()
-			if err != nil {
-				return
-			}
-			a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeGauge, ID: "TotalMemory", Value: int64(v.Total)})
-			a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeGauge, ID: "FreeMemory", Value: int64(v.Free)})
-			a.Metrics = append(a.Metrics, m.AgentMetric{MType: m.TypeGauge, ID: "CPUutilization1", Value: v.UsedPercent})
-		case <-ctx.Done():
-			poll.Stop()
-			return
-		}
+func (a *Agent) send(ctx context.Context, batch []m.AgentMetric) error {
+	if a.grpc != nil {
+		return a.sendGRPC(ctx, batch)
 	}
+	return a.sendHTTP(ctx, batch)
 }
 
-func (a *Agent) SendAllMetrics(ctx context.Context) error {
-	b, err := json.Marshal(a.Metrics)
+func (a *Agent) sendHTTP(ctx context.Context, batch []m.AgentMetric) error {
+	b, err := json.Marshal(batch)
 	if err != nil {
 		a.logger.Error().Err(err).Msg("Marshalling error")
 		return err
 	}
 	a.logger.Info().Any("json", string(b)).Msg("Marshalled")
-
 	buf := &bytes.Buffer{}
 	a.gw.Reset(buf)
 	n, err := a.gw.Write(b)
@@ -248,31 +206,130 @@ func (a *Agent) SendAllMetrics(ctx context.Context) error {
 		return err
 	}
 	a.gw.Close()
-
 	a.logger.Info().
 		Int("len of b", len(b)).
 		Int("written bytes", n).
 		Int("len of buf", len(buf.Bytes())).
 		Send()
-
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/updates/", a.address), buf)
 	if err != nil {
 		a.logger.Error().Err(err).Msg("http.NewRequestWithContext method error")
 		return err
 	}
+	if a.key != "" {
+		buf2 := *buf
+		h := hmac.New(sha256.New, []byte(a.key))
+		if _, err := h.Write(buf2.Bytes()); err != nil {
+			return err
+		}
+		d := h.Sum(nil)
+		a.logger.Info().Msgf("hash: %x", d)
+		req.Header.Add("HashSHA256", hex.EncodeToString(d))
+	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Content-Encoding", "gzip")
-
 	res, err := a.client.Do(req)
 	if err != nil {
 		a.logger.Error().Err(err).Msg("client.Do method error")
 		return err
 	}
 	res.Body.Close()
-	a.logger.Info().Any("metric", a.Metrics).Msg("Metrics are sent")
+	if res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError {
+		// the server won't accept the batch however often it is sent
+		err := fmt.Errorf("%w: server responded with %s", spool.ErrRejected, res.Status)
+		a.logger.Error().Err(err).Msg("client.Do method error")
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		err := fmt.Errorf("server responded with %s", res.Status)
+		a.logger.Error().Err(err).Msg("client.Do method error")
+		return err
+	}
+	a.logger.Info().Any("metric", batch).Msg("Metrics are sent")
 	return nil
 }
 
+func (a *Agent) sendGRPC(ctx context.Context, batch []m.AgentMetric) error {
+	req := &pb.UpdateMetricsRequest{Metrics: make([]*pb.Metric, 0, len(batch))}
+	for _, metric := range batch {
+		pm, err := toProto(metric)
+		if err != nil {
+			a.logger.Error().Err(err).Str("name", metric.ID).Msg("Invalid metric is skipped")
+			continue
+		}
+		req.Metrics = append(req.Metrics, pm)
+	}
+	if a.key != "" {
+		req.Hash = pb.SignUpdate(req, a.key)
+	}
+
+	stream, err := a.grpc.UpdateMetrics(ctx)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("UpdateMetrics method error")
+		return err
+	}
+	if err := stream.Send(req); err != nil {
+		a.logger.Error().Err(err).Msg("stream.Send method error")
+		return err
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		a.logger.Error().Err(err).Msg("stream.CloseAndRecv method error")
+		if status.Code(err) == codes.InvalidArgument {
+			return fmt.Errorf("%w: %w", spool.ErrRejected, err)
+		}
+		return err
+	}
+	a.logger.Info().Int64("stored", res.GetStored()).Msg("Metrics are sent")
+	return nil
+}
+
+// toProto converts the metric values collected with their own types.
+func toProto(metric m.AgentMetric) (*pb.Metric, error) {
+	res := &pb.Metric{Id: metric.ID, Type: metric.MType, Labels: metric.Labels}
+	switch metric.MType {
+	case m.TypeCounter:
+		delta, ok := toFloat(metric.Delta)
+		if !ok {
+			return nil, fmt.Errorf("counter delta %v isn't a number", metric.Delta)
+		}
+		d := int64(delta)
+		res.Delta = &d
+	case m.TypeGauge:
+		value, ok := toFloat(metric.Value)
+		if !ok {
+			return nil, fmt.Errorf("gauge value %v isn't a number", metric.Value)
+		}
+		res.Value = &value
+	default:
+		return nil, fmt.Errorf("unsupported metric type %s", metric.MType)
+	}
+	return res, nil
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// SendAllMetrics sends the metrics collected since the last report.
+func (a *Agent) SendAllMetrics(ctx context.Context) error {
+	return a.send(ctx, a.registry.Snapshot())
+}
+
 func (a *Agent) Retry(ctx context.Context, maxRetries int, fn func(ctx context.Context) error) error {
 	// Инициализация экспоненциальной стратегии отката
 	expBackOff := backoff.NewExponentialBackOff()
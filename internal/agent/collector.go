@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Collector gathers a group of metrics into the registry on every poll. An
+// error of Collect is logged and counted in CollectorErrors, the collector is
+// polled again on its next tick and the other collectors are not affected.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context, r *Registry) error
+}
+
+// Collectors are the built-in collectors by name.
+var Collectors = map[string]func() Collector{
+	"runtime":  func() Collector { return RuntimeCollector{} },
+	"gopsutil": func() Collector { return &GopsutilCollector{} },
+	"disk":     func() Collector { return &DiskCollector{} },
+	"net":      func() Collector { return &NetCollector{} },
+}
+
+// NewCollector returns the built-in collector with the name.
+func NewCollector(name string) (Collector, error) {
+	newCollector, ok := Collectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown collector %q", name)
+	}
+	return newCollector(), nil
+}
+
+type collector struct {
+	Collector
+	interval time.Duration
+}
+
+// Register adds the collector polled every interval, it must be called before
+// RunCollectors.
+func (a *Agent) Register(c Collector, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("collector %s: interval must be positive", c.Name())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, registered := range a.collectors {
+		if registered.Name() == c.Name() {
+			return fmt.Errorf("collector %s is already registered", c.Name())
+		}
+	}
+	a.collectors = append(a.collectors, collector{Collector: c, interval: interval})
+	return nil
+}
+
+// RunCollectors polls every registered collector on its own interval until
+// ctx is done.
+func (a *Agent) RunCollectors(ctx context.Context) {
+	a.mu.Lock()
+	collectors := append([]collector(nil), a.collectors...)
+	a.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range collectors {
+		wg.Add(1)
+		go func(c collector) {
+			defer wg.Done()
+			a.runCollector(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (a *Agent) runCollector(ctx context.Context, c collector) {
+	poll := time.NewTicker(c.interval)
+	defer poll.Stop()
+
+	for {
+		select {
+		case <-poll.C:
+			if err := a.collect(ctx, c); err != nil {
+				a.logger.Error().Err(err).Str("collector", c.Name()).Msg("Collect method error")
+				a.registry.AddCounter("CollectorErrors", 1, map[string]string{"collector": c.Name()})
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collect turns a panic of the collector into an error, so it doesn't take
+// the agent down.
+func (a *Agent) collect(ctx context.Context, c Collector) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return c.Collect(ctx, a.registry)
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DiskCollector reports the usage of every mounted physical device labeled
+// with the mountpoint and device, see metrics.DiskGaugeMetrics, and the IO of
+// every block device labeled with the device, see metrics.DiskCounterMetrics.
+type DiskCollector struct {
+	io ioCounters
+}
+
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+// Collect reports what it could gather when a part of the metrics fails.
+func (c *DiskCollector) Collect(ctx context.Context, r *Registry) error {
+	return errors.Join(
+		c.collectUsage(ctx, r),
+		c.collectIO(ctx, r),
+	)
+}
+
+func (c *DiskCollector) collectUsage(ctx context.Context, r *Registry) error {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return fmt.Errorf("disk partitions: %w", err)
+	}
+
+	var errs []error
+	for _, p := range partitions {
+		u, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("disk usage of %s: %w", p.Mountpoint, err))
+			continue
+		}
+		labels := map[string]string{"mountpoint": p.Mountpoint, "device": p.Device}
+		r.SetGauge("DiskTotal", int64(u.Total), labels)
+		r.SetGauge("DiskFree", int64(u.Free), labels)
+		r.SetGauge("DiskUsedPercent", u.UsedPercent, labels)
+		r.SetGauge("DiskInodesTotal", int64(u.InodesTotal), labels)
+		r.SetGauge("DiskInodesFree", int64(u.InodesFree), labels)
+		r.SetGauge("DiskInodesUsedPercent", u.InodesUsedPercent, labels)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *DiskCollector) collectIO(ctx context.Context, r *Registry) error {
+	counters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("disk io: %w", err)
+	}
+
+	samples := make([]ioSample, 0, 4*len(counters))
+	for device, io := range counters {
+		labels := map[string]string{"device": device}
+		samples = append(samples,
+			ioSample{name: "DiskReadBytes", labels: labels, value: io.ReadBytes},
+			ioSample{name: "DiskWriteBytes", labels: labels, value: io.WriteBytes},
+			ioSample{name: "DiskReads", labels: labels, value: io.ReadCount},
+			ioSample{name: "DiskWrites", labels: labels, value: io.WriteCount},
+		)
+	}
+	c.io.update(r, time.Now(), samples)
+	return nil
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// GopsutilCollector reports the system metrics gathered with gopsutil, see
+// metrics.GopsutilGaugeMetrics. The CPU utilization is computed over the time
+// since the previous poll, the first poll reports it since boot.
+type GopsutilCollector struct {
+	total cpu.TimesStat
+	cores []cpu.TimesStat
+}
+
+func (c *GopsutilCollector) Name() string {
+	return "gopsutil"
+}
+
+// Collect reports what it could gather when a part of the metrics fails.
+func (c *GopsutilCollector) Collect(ctx context.Context, r *Registry) error {
+	return errors.Join(
+		c.collectMemory(ctx, r),
+		c.collectCPU(ctx, r),
+		c.collectLoad(ctx, r),
+	)
+}
+
+func (c *GopsutilCollector) collectMemory(ctx context.Context, r *Registry) error {
+	v, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("memory: %w", err)
+	}
+	r.SetGauge("TotalMemory", int64(v.Total), nil)
+	r.SetGauge("FreeMemory", int64(v.Free), nil)
+	return nil
+}
+
+func (c *GopsutilCollector) collectCPU(ctx context.Context, r *Registry) error {
+	cores, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return fmt.Errorf("cpu: %w", err)
+	}
+	total, err := cpu.TimesWithContext(ctx, false)
+	if err != nil {
+		return fmt.Errorf("cpu: %w", err)
+	}
+	if len(total) == 0 {
+		return errors.New("cpu: no times")
+	}
+
+	// the cores were plugged in or out, start over
+	if len(cores) != len(c.cores) {
+		c.cores = make([]cpu.TimesStat, len(cores))
+	}
+	for i, core := range cores {
+		busy, _, _ := cpuPercent(c.cores[i], core)
+		r.SetGauge(fmt.Sprintf("CPUutilization%d", i+1), busy, nil)
+	}
+	c.cores = cores
+
+	busy, iowait, steal := cpuPercent(c.total, total[0])
+	r.SetGauge("CPUutilization", busy, nil)
+	r.SetGauge("CPUiowait", iowait, nil)
+	r.SetGauge("CPUsteal", steal, nil)
+	c.total = total[0]
+	return nil
+}
+
+func (c *GopsutilCollector) collectLoad(ctx context.Context, r *Registry) error {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+	r.SetGauge("LoadAverage1", avg.Load1, nil)
+	r.SetGauge("LoadAverage5", avg.Load5, nil)
+	r.SetGauge("LoadAverage15", avg.Load15, nil)
+	return nil
+}
+
+// cpuPercent returns the busy, iowait and steal shares of the CPU time
+// between the samples in percent. The guest time is a part of the user time.
+func cpuPercent(prev, cur cpu.TimesStat) (busy, iowait, steal float64) {
+	all := cpuTotal(cur) - cpuTotal(prev)
+	if all <= 0 {
+		return 0, 0, 0
+	}
+	idle := (cur.Idle - prev.Idle) + (cur.Iowait - prev.Iowait)
+	busy = clampPercent((all - idle) / all * 100)
+	iowait = clampPercent((cur.Iowait - prev.Iowait) / all * 100)
+	steal = clampPercent((cur.Steal - prev.Steal) / all * 100)
+	return busy, iowait, steal
+}
+
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+func clampPercent(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 100 {
+		return 100
+	}
+	return v
+}
@@ -0,0 +1,37 @@
+package agent
+
+import "time"
+
+type ioSample struct {
+	name   string
+	labels map[string]string
+	value  uint64
+}
+
+// ioCounters turns the cumulative counters of the system into counter deltas
+// and per second rate gauges named <name>Rate. A series is reported from its
+// second poll on, so an agent restart doesn't count the totals since boot
+// again, and it is skipped when its counter went back.
+type ioCounters struct {
+	time   time.Time
+	values map[string]uint64
+}
+
+func (c *ioCounters) update(r *Registry, now time.Time, samples []ioSample) {
+	elapsed := now.Sub(c.time).Seconds()
+	values := make(map[string]uint64, len(samples))
+	for _, s := range samples {
+		key := registryKey("", s.name, s.labels)
+		values[key] = s.value
+
+		prev, ok := c.values[key]
+		if !ok || s.value < prev || elapsed <= 0 {
+			continue
+		}
+		delta := s.value - prev
+		r.AddCounter(s.name, int64(delta), s.labels)
+		r.SetGauge(s.name+"Rate", float64(delta)/elapsed, s.labels)
+	}
+	c.time = now
+	c.values = values
+}
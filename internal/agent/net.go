@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// NetCollector reports the traffic of every network interface labeled with
+// the device, see metrics.NetCounterMetrics.
+type NetCollector struct {
+	io ioCounters
+}
+
+func (c *NetCollector) Name() string {
+	return "net"
+}
+
+func (c *NetCollector) Collect(ctx context.Context, r *Registry) error {
+	counters, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return fmt.Errorf("net io: %w", err)
+	}
+
+	samples := make([]ioSample, 0, 8*len(counters))
+	for _, io := range counters {
+		labels := map[string]string{"device": io.Name}
+		samples = append(samples,
+			ioSample{name: "NetBytesSent", labels: labels, value: io.BytesSent},
+			ioSample{name: "NetBytesRecv", labels: labels, value: io.BytesRecv},
+			ioSample{name: "NetPacketsSent", labels: labels, value: io.PacketsSent},
+			ioSample{name: "NetPacketsRecv", labels: labels, value: io.PacketsRecv},
+			ioSample{name: "NetErrorsIn", labels: labels, value: io.Errin},
+			ioSample{name: "NetErrorsOut", labels: labels, value: io.Errout},
+			ioSample{name: "NetDropsIn", labels: labels, value: io.Dropin},
+			ioSample{name: "NetDropsOut", labels: labels, value: io.Dropout},
+		)
+	}
+	c.io.update(r, time.Now(), samples)
+	return nil
+}
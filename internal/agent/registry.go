@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+
+	m "github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// Registry holds the metrics collected since the last report, a metric per
+// type and series. Gauges keep their latest value, counters accumulate
+// their deltas. The labels of the registry are added to every metric. It is
+// safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	labels  map[string]string
+	metrics map[string]m.AgentMetric
+}
+
+func NewRegistry(labels map[string]string) *Registry {
+	return &Registry{labels: labels, metrics: make(map[string]m.AgentMetric)}
+}
+
+func (r *Registry) withLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return r.labels
+	}
+	if len(r.labels) == 0 {
+		return labels
+	}
+	res := make(map[string]string, len(r.labels)+len(labels))
+	for name, value := range r.labels {
+		res[name] = value
+	}
+	for name, value := range labels {
+		res[name] = value
+	}
+	return res
+}
+
+func registryKey(mtype, name string, labels map[string]string) string {
+	return mtype + ":" + m.SeriesKey(name, labels)
+}
+
+// SetGauge replaces the value of the gauge.
+func (r *Registry) SetGauge(name string, value any, labels map[string]string) {
+	labels = r.withLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics[registryKey(m.TypeGauge, name, labels)] = m.AgentMetric{MType: m.TypeGauge, ID: name, Value: value, Labels: labels}
+}
+
+// AddCounter adds delta to the counter.
+func (r *Registry) AddCounter(name string, delta int64, labels map[string]string) {
+	labels = r.withLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := registryKey(m.TypeCounter, name, labels)
+	if c, ok := r.metrics[key]; ok {
+		delta += c.Delta.(int64)
+	}
+	r.metrics[key] = m.AgentMetric{MType: m.TypeCounter, ID: name, Delta: delta, Labels: labels}
+}
+
+// Snapshot returns the metrics ordered by type and series and resets the
+// registry, so every counter delta is reported once.
+func (r *Registry) Snapshot() []m.AgentMetric {
+	r.mu.Lock()
+	metrics := r.metrics
+	r.metrics = make(map[string]m.AgentMetric, len(metrics))
+	r.mu.Unlock()
+
+	keys := make([]string, 0, len(metrics))
+	for key := range metrics {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	res := make([]m.AgentMetric, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, metrics[key])
+	}
+	return res
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+
+	m "github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// RuntimeCollector reports the runtime.MemStats fields listed in
+// metrics.GaugeMetrics, RandomValue and PollCount.
+type RuntimeCollector struct{}
+
+func (RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+func (RuntimeCollector) Collect(ctx context.Context, r *Registry) error {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	msvalue := reflect.ValueOf(memStats)
+
+	for _, metric := range m.GaugeMetrics {
+		value := msvalue.FieldByName(metric)
+		if !value.IsValid() {
+			return fmt.Errorf("runtime.MemStats has no field %s", metric)
+		}
+		r.SetGauge(metric, value.Interface(), nil)
+	}
+
+	r.SetGauge("RandomValue", rand.Float64(), nil)
+	r.AddCounter("PollCount", 1, nil)
+	return nil
+}
@@ -0,0 +1,334 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/notifier"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+type Service interface {
+	GetMetric(mtype, mname string, labels map[string]string) (*metrics.Metric, error)
+}
+
+var ErrNotActive = errors.New("alert is neither pending nor firing")
+
+type Storage interface {
+	repository.AlertStorage
+	repository.RuleStorage
+	repository.SilenceStorage
+	repository.HistoryStorage
+}
+
+type Evaluator struct {
+	mu       sync.Mutex
+	logger   *zerolog.Logger
+	service  Service
+	storage  Storage
+	queue    *notifier.Queue
+	renotify time.Duration
+	alerts   map[string]metrics.Alert
+	last     map[string]float64
+}
+
+// NewEvaluator creates an evaluator that repeats the notifications of firing
+// alerts every renotify until they are acknowledged, renotify <= 0 disables it.
+func NewEvaluator(l *zerolog.Logger, srv Service, storage Storage, queue *notifier.Queue, renotify time.Duration) *Evaluator {
+	return &Evaluator{
+		logger:   l,
+		service:  srv,
+		storage:  storage,
+		queue:    queue,
+		renotify: renotify,
+		alerts:   make(map[string]metrics.Alert),
+		last:     make(map[string]float64),
+	}
+}
+
+// Restore loads the persisted alert states so pending and firing alerts
+// survive restarts.
+func (e *Evaluator) Restore() error {
+	alerts, err := e.storage.LoadAlerts()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, a := range alerts {
+		e.alerts[a.RuleID] = a
+	}
+	return nil
+}
+
+func (e *Evaluator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			e.Evaluate(now)
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Evaluate checks every enabled rule against the current metric values once
+// and queues notifications about the alerts that fired or resolved unless
+// they are silenced.
+func (e *Evaluator) Evaluate(now time.Time) {
+	e.dispatch(e.evaluate(now), now)
+}
+
+// Retire drops the alert state of a disabled, deleted or changed rule. A
+// firing alert is resolved first, so the receivers learn it's over.
+func (e *Evaluator) Retire(rule metrics.AlertRule, now time.Time) {
+	e.mu.Lock()
+	notifications := e.retire(rule, now)
+	e.mu.Unlock()
+
+	e.dispatch(notifications, now)
+}
+
+// dispatch queues the notifications unless they are silenced.
+func (e *Evaluator) dispatch(notifications []metrics.Notification, now time.Time) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	silences, err := e.storage.LoadSilences()
+	if err != nil {
+		e.logger.Error().Err(err).Msg("Failed to load silences")
+	}
+
+	for _, n := range notifications {
+		if s := Silenced(silences, n, now); s != nil {
+			e.logger.Info().
+				Str("rule", n.RuleID).
+				Str("silence", s.ID).
+				Msg("Alert notification is silenced")
+			e.appendEvent(metrics.AlertEvent{
+				RuleID:  n.RuleID,
+				Kind:    metrics.EventSilenced,
+				State:   n.State,
+				Value:   n.Value,
+				Comment: s.Comment,
+				Time:    now,
+			})
+			continue
+		}
+		if err := e.queue.Enqueue(n); err != nil {
+			e.logger.Error().Err(err).Str("rule", n.RuleID).Msg("Failed to queue alert notification")
+		}
+	}
+}
+
+func (e *Evaluator) evaluate(now time.Time) []metrics.Notification {
+	rules, err := e.storage.LoadRules()
+	if err != nil {
+		e.logger.Error().Err(err).Msg("Failed to load alert rules")
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var notifications []metrics.Notification
+
+	// the state of the rules disabled or deleted bypassing the API, e.g. by
+	// another server of the database
+	known := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		known[rule.ID] = true
+	}
+	for id := range e.alerts {
+		if !known[id] {
+			notifications = append(notifications, e.retire(metrics.AlertRule{ID: id}, now)...)
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.Disabled {
+			notifications = append(notifications, e.retire(rule, now)...)
+			continue
+		}
+		logger := e.logger.With().
+			Str("rule", rule.ID).
+			Str("type", rule.MType).
+			Str("name", metrics.SeriesKey(rule.MName, rule.Labels)).
+			Logger()
+
+		m, err := e.service.GetMetric(rule.MType, rule.MName, rule.Labels)
+		if err != nil {
+			logger.Debug().Err(err).Msg("Metric for alert rule not found")
+			continue
+		}
+		value, ok := metrics.ValueOf(*m)
+		if !ok {
+			continue
+		}
+
+		var prev *float64
+		if v, ok := e.last[rule.ID]; ok {
+			prev = &v
+		}
+		e.last[rule.ID] = value
+
+		current, ok := e.alerts[rule.ID]
+		if !ok {
+			current.State = metrics.AlertInactive
+		}
+		next := Next(rule, current, Match(rule, value, prev), Cleared(rule, value, prev), value, now)
+		changed := next.State != current.State
+		notify := changed && (next.State == metrics.AlertFiring || next.State == metrics.AlertResolved)
+		if !changed && e.renotifyDue(next, now) {
+			notify = true
+		}
+		if notify {
+			next.NotifiedAt = &now
+		}
+		e.alerts[rule.ID] = next
+		if !changed && !notify {
+			continue
+		}
+
+		if changed {
+			logger.Warn().
+				Float64("value", value).
+				Str("from", current.State).
+				Str("to", next.State).
+				Msg("Alert state changed")
+			e.appendEvent(metrics.AlertEvent{
+				RuleID: rule.ID,
+				Kind:   next.State,
+				State:  next.State,
+				Value:  value,
+				Time:   now,
+			})
+		}
+		if err := e.storage.StoreAlert(next); err != nil {
+			logger.Error().Err(err).Msg("Failed to store alert state")
+		}
+		if notify {
+			notifications = append(notifications, notification(rule, next, m.Labels))
+		}
+	}
+	return notifications
+}
+
+// retire expects the caller to hold the lock.
+func (e *Evaluator) retire(rule metrics.AlertRule, now time.Time) []metrics.Notification {
+	delete(e.last, rule.ID)
+	a, ok := e.alerts[rule.ID]
+	if !ok {
+		return nil
+	}
+	delete(e.alerts, rule.ID)
+	if err := e.storage.DeleteAlert(rule.ID); err != nil {
+		e.logger.Error().Err(err).Str("rule", rule.ID).Msg("Failed to delete alert state")
+	}
+	if a.State != metrics.AlertFiring {
+		return nil
+	}
+
+	a.State = metrics.AlertResolved
+	a.ResolvedAt = &now
+	a.UpdatedAt = now
+	e.logger.Warn().
+		Str("rule", rule.ID).
+		Str("from", metrics.AlertFiring).
+		Str("to", a.State).
+		Msg("Alert of a disabled, deleted or changed rule is resolved")
+	e.appendEvent(metrics.AlertEvent{
+		RuleID:  rule.ID,
+		Kind:    a.State,
+		State:   a.State,
+		Value:   a.Value,
+		Comment: "rule is disabled, deleted or changed",
+		Time:    now,
+	})
+	return []metrics.Notification{notification(rule, a, rule.Labels)}
+}
+
+func (e *Evaluator) renotifyDue(a metrics.Alert, now time.Time) bool {
+	return e.renotify > 0 &&
+		a.State == metrics.AlertFiring &&
+		a.AcknowledgedAt == nil &&
+		a.NotifiedAt != nil &&
+		now.Sub(*a.NotifiedAt) >= e.renotify
+}
+
+// Acknowledge marks the pending or firing alert of the rule as handled by
+// someone, which stops its re-notifications.
+func (e *Evaluator) Acknowledge(ruleID, by, comment string, now time.Time) (*metrics.Alert, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a, ok := e.alerts[ruleID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	if a.State != metrics.AlertPending && a.State != metrics.AlertFiring {
+		return nil, ErrNotActive
+	}
+	a.AcknowledgedBy = by
+	a.AcknowledgedAt = &now
+
+	if err := e.storage.StoreAlert(a); err != nil {
+		return nil, err
+	}
+	e.alerts[ruleID] = a
+	e.appendEvent(metrics.AlertEvent{
+		RuleID:  ruleID,
+		Kind:    metrics.EventAcknowledged,
+		State:   a.State,
+		Value:   a.Value,
+		Actor:   by,
+		Comment: comment,
+		Time:    now,
+	})
+	return &a, nil
+}
+
+// Alerts returns the current alert states ordered by rule.
+func (e *Evaluator) Alerts() []metrics.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]metrics.Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].RuleID < alerts[j].RuleID })
+	return alerts
+}
+
+func (e *Evaluator) appendEvent(event metrics.AlertEvent) {
+	if err := e.storage.AppendEvent(event); err != nil {
+		e.logger.Error().Err(err).Str("rule", event.RuleID).Msg("Failed to append alert history event")
+	}
+}
+
+// notification describes the alert of the rule on the series with the labels.
+func notification(rule metrics.AlertRule, a metrics.Alert, labels map[string]string) metrics.Notification {
+	return metrics.Notification{
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		MType:     rule.MType,
+		MName:     rule.MName,
+		Condition: rule.Condition,
+		Threshold: rule.Threshold,
+		State:     a.State,
+		Value:     a.Value,
+		Time:      a.UpdatedAt,
+		Labels:    labels,
+	}
+}
@@ -0,0 +1,106 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+var (
+	ErrInvalidRule      = errors.New("invalid alert rule")
+	ErrUnknownCondition = errors.New("unknown alert condition")
+)
+
+func Validate(rule metrics.AlertRule) error {
+	if rule.ID == "" || rule.MName == "" {
+		return fmt.Errorf("%w: id and metric are required", ErrInvalidRule)
+	}
+	if rule.For < 0 || rule.Hysteresis < 0 {
+		return fmt.Errorf("%w: for and hysteresis can't be negative", ErrInvalidRule)
+	}
+	if rule.MType != metrics.TypeCounter && rule.MType != metrics.TypeGauge {
+		return fmt.Errorf("%w: unsupported metric type %q", ErrInvalidRule, rule.MType)
+	}
+	switch rule.Condition {
+	case metrics.ConditionGreater, metrics.ConditionGreaterEqual,
+		metrics.ConditionLess, metrics.ConditionLessEqual,
+		metrics.ConditionEqual, metrics.ConditionNotEqual,
+		metrics.ConditionStale:
+		return nil
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownCondition, rule.Condition)
+}
+
+// Changed reports whether the rule selects another series or has another
+// condition than the old one, the alert state of the old rule doesn't apply
+// to it then.
+func Changed(old, rule metrics.AlertRule) bool {
+	return old.MType != rule.MType ||
+		old.MName != rule.MName ||
+		!maps.Equal(old.Labels, rule.Labels) ||
+		old.Condition != rule.Condition ||
+		old.Threshold != rule.Threshold ||
+		old.For != rule.For ||
+		old.Hysteresis != rule.Hysteresis
+}
+
+// LoadRules reads a JSON array of rules from the file.
+func LoadRules(path string) ([]metrics.AlertRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []metrics.AlertRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if err := Validate(rule); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Match reports whether value violates the rule. prev is the value seen on the
+// previous evaluation, nil if there was none.
+func Match(rule metrics.AlertRule, value float64, prev *float64) bool {
+	switch rule.Condition {
+	case metrics.ConditionGreater:
+		return value > rule.Threshold
+	case metrics.ConditionGreaterEqual:
+		return value >= rule.Threshold
+	case metrics.ConditionLess:
+		return value < rule.Threshold
+	case metrics.ConditionLessEqual:
+		return value <= rule.Threshold
+	case metrics.ConditionEqual:
+		return value == rule.Threshold
+	case metrics.ConditionNotEqual:
+		return value != rule.Threshold
+	case metrics.ConditionStale:
+		return prev != nil && *prev == value
+	}
+	return false
+}
+
+// Cleared reports whether value is far enough from the threshold to resolve
+// a firing alert, taking the rule hysteresis into account.
+func Cleared(rule metrics.AlertRule, value float64, prev *float64) bool {
+	switch rule.Condition {
+	case metrics.ConditionGreater:
+		return value <= rule.Threshold-rule.Hysteresis
+	case metrics.ConditionGreaterEqual:
+		return value < rule.Threshold-rule.Hysteresis
+	case metrics.ConditionLess:
+		return value >= rule.Threshold+rule.Hysteresis
+	case metrics.ConditionLessEqual:
+		return value > rule.Threshold+rule.Hysteresis
+	}
+	return !Match(rule, value, prev)
+}
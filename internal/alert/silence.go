@@ -0,0 +1,53 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// HostLabel is the label that identifies the agent host of a series, the
+// agents set it with -labels host:<name>. A rule evaluates the series with
+// exactly its labels, so a host silence only matches the alerts of the rules
+// with the host label.
+const HostLabel = "host"
+
+func ValidateSilence(s metrics.Silence) error {
+	if s.Metric == "" && s.MType == "" && s.Host == "" {
+		return fmt.Errorf("%w: at least one of metric, type and host is required", ErrInvalidSilence)
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("%w: ends_at has to be after starts_at", ErrInvalidSilence)
+	}
+	return nil
+}
+
+// Active reports whether the silence is in effect at the moment.
+func Active(s metrics.Silence, now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// Silenced returns the first active silence that matches the notification, nil if there is none. A host
+// silence matches the host label of the evaluated series.
+func Silenced(silences []metrics.Silence, n metrics.Notification, now time.Time) *metrics.Silence {
+	for i, s := range silences {
+		if !Active(s, now) {
+			continue
+		}
+		if s.Metric != "" && s.Metric != n.MName {
+			continue
+		}
+		if s.MType != "" && s.MType != n.MType {
+			continue
+		}
+		if s.Host != "" && s.Host != n.Labels[HostLabel] {
+			continue
+		}
+		return &silences[i]
+	}
+	return nil
+}
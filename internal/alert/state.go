@@ -0,0 +1,56 @@
+package alert
+
+import (
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// Next moves the alert through inactive → pending → firing → resolved.
+// matched tells whether the rule condition holds for the current value and
+// cleared whether the value has moved back past the hysteresis band.
+func Next(rule metrics.AlertRule, a metrics.Alert, matched, cleared bool, value float64, now time.Time) metrics.Alert {
+	a.RuleID = rule.ID
+	a.Value = value
+	a.UpdatedAt = now
+	if a.State == "" {
+		a.State = metrics.AlertInactive
+	}
+
+	switch a.State {
+	case metrics.AlertInactive, metrics.AlertResolved:
+		if !matched {
+			return a
+		}
+		a.State = metrics.AlertPending
+		a.ActiveAt = &now
+		a.FiredAt = nil
+		a.ResolvedAt = nil
+		a.AcknowledgedBy = ""
+		a.AcknowledgedAt = nil
+		a.NotifiedAt = nil
+		if rule.For == 0 {
+			a.State = metrics.AlertFiring
+			a.FiredAt = &now
+		}
+	case metrics.AlertPending:
+		if !matched {
+			a.State = metrics.AlertInactive
+			a.ActiveAt = nil
+			return a
+		}
+		if a.ActiveAt == nil {
+			a.ActiveAt = &now
+		}
+		if now.Sub(*a.ActiveAt) >= time.Duration(rule.For)*time.Second {
+			a.State = metrics.AlertFiring
+			a.FiredAt = &now
+		}
+	case metrics.AlertFiring:
+		if cleared {
+			a.State = metrics.AlertResolved
+			a.ResolvedAt = &now
+		}
+	}
+	return a
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/DieOfCode/go-alert-service/internal/alert"
 	"github.com/DieOfCode/go-alert-service/internal/configuration"
+	"github.com/DieOfCode/go-alert-service/internal/graphite"
+	"github.com/DieOfCode/go-alert-service/internal/grpcserver"
 	"github.com/DieOfCode/go-alert-service/internal/handler"
+	"github.com/DieOfCode/go-alert-service/internal/notifier"
 	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/DieOfCode/go-alert-service/internal/retention"
+	"github.com/DieOfCode/go-alert-service/internal/statsd"
 	s "github.com/DieOfCode/go-alert-service/internal/storage"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -22,8 +29,19 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
 )
 
+// backend is a storage that keeps the alerting state next to the metric data.
+type backend interface {
+	repository.Storage
+	repository.AlertStorage
+	repository.RuleStorage
+	repository.DeliveryStorage
+	repository.SilenceStorage
+	repository.HistoryStorage
+}
+
 func Run() {
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
@@ -33,7 +51,7 @@ func Run() {
 		return
 	}
 
-	var storage repository.Storage
+	var storage backend
 	var db *sql.DB
 	logger.Info().Msg(cfg.DatabaseDSN)
 	if cfg.DatabaseDSN != "" {
@@ -45,13 +63,16 @@ func Run() {
 		defer db.Close()
 		storage = s.NewDatabaseStorage(&logger, db)
 	} else {
-		storage = s.NewMemStorage(&logger, *cfg.StoreInterval, cfg.FileStoragePath)
+		storage = s.NewMemStorage(&logger, *cfg.StoreInterval, cfg.FileStoragePath, *cfg.SamplesLimit, cfg.HistoryLimit)
 
 	}
 
-	repository := repository.New(&logger, storage)
+	repository := repository.New(&logger, storage, cfg.Retention())
+
+	queue := notifier.NewQueue(&logger, storage, notifier.New(&logger, cfg), cfg.NotifyAttempts)
+	evaluator := alert.NewEvaluator(&logger, repository, storage, queue, time.Duration(cfg.AlertRenotify)*time.Second)
 
-	server := NewServer(&logger, cfg.ServerAddress, repository, db)
+	server := NewServer(&logger, cfg.ServerAddress, repository, storage, evaluator, db)
 	server.RegisterHandler(cfg)
 	if *cfg.Restore {
 		err := storage.RestoreFromFile()
@@ -83,11 +104,82 @@ func Run() {
 		}()
 	}
 
+	if cfg.AlertRulesFile != "" {
+		if err := seedRules(storage, cfg.AlertRulesFile); err != nil {
+			logger.Error().Err(err).Msg("Failed to load alert rules")
+		}
+	}
+
+	if err := evaluator.Restore(); err != nil {
+		logger.Error().Err(err).Msg("Failed to restore alert states")
+	}
+	go queue.Run(ctx, time.Second)
+	if cfg.RollupInterval > 0 {
+		go retention.New(&logger, storage, cfg.Retention()).Run(ctx, time.Duration(cfg.RollupInterval)*time.Second)
+	}
+	if cfg.AlertInterval > 0 {
+		go evaluator.Run(ctx, time.Duration(cfg.AlertInterval)*time.Second)
+	}
+
+	var statsdDone chan struct{}
+	if cfg.StatsDAddress != "" {
+		listener, err := statsd.Listen(&logger, cfg.StatsDAddress, repository, time.Duration(cfg.StatsDFlush)*time.Second)
+		if err != nil {
+			logger.Error().Err(err).Msg("StatsD listener initializing error")
+			return
+		}
+		statsdDone = make(chan struct{})
+		go func() {
+			listener.Serve(ctx)
+			close(statsdDone)
+		}()
+	}
+
+	var graphiteDone chan struct{}
+	if cfg.GraphiteAddress != "" {
+		listener, err := graphite.Listen(&logger, cfg.GraphiteAddress, repository)
+		if err != nil {
+			logger.Error().Err(err).Msg("Graphite listener initializing error")
+			return
+		}
+		graphiteDone = make(chan struct{})
+		go func() {
+			listener.Serve(ctx)
+			close(graphiteDone)
+		}()
+	}
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", cfg.GRPCAddress)
+		if err != nil {
+			logger.Error().Err(err).Msg("gRPC server initializing error")
+			return
+		}
+		grpcServer = grpcserver.NewGRPCServer(&logger, repository, cfg.Key)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error().Err(err).Msg("gRPC server error")
+			}
+		}()
+	}
+
 	go server.ListenAndServe(&cfg)
 
 	<-ctx.Done()
 	logger.Info().Msg("Shutdown signal received")
 
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	// the listeners store what they received before the storage is written
+	if statsdDone != nil {
+		<-statsdDone
+	}
+	if graphiteDone != nil {
+		<-graphiteDone
+	}
+
 	if err := storage.WriteToFile(); err != nil {
 		logger.Error().Err(err).Msg("Failed to write storage content to file")
 	}
@@ -102,6 +194,28 @@ func Run() {
 	logger.Info().Msg("Server stopped gracefully")
 }
 
+// seedRules stores the rules from the file that aren't known to the storage yet,
+// so changes made over the API survive restarts.
+func seedRules(storage repository.RuleStorage, path string) error {
+	rules, err := alert.LoadRules(path)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		_, err := storage.LoadRule(rule.ID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if err := storage.StoreRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // func connectDB(logger *zerolog.Logger, cfg *configuration.Config) (*sql.DB, error) {
 // 	db, err := sql.Open("pgx", cfg.DatabaseDSN)
 // 	if err != nil {
@@ -176,39 +290,81 @@ func DBPing(logger *zerolog.Logger, db *sql.DB) http.Handler {
 }
 
 type Server struct {
-	server *http.Server
-	logger *zerolog.Logger
-	repo   *repository.Repository
-	db     *sql.DB
+	server    *http.Server
+	logger    *zerolog.Logger
+	repo      *repository.Repository
+	storage   backend
+	evaluator *alert.Evaluator
+	db        *sql.DB
 }
 
-func NewServer(l *zerolog.Logger, addr string, repo *repository.Repository, db *sql.DB) *Server {
+func NewServer(l *zerolog.Logger, addr string, repo *repository.Repository, storage backend, evaluator *alert.Evaluator, db *sql.DB) *Server {
 	return &Server{
-		server: &http.Server{Addr: addr},
-		logger: l,
-		repo:   repo,
-		db:     db,
+		server:    &http.Server{Addr: addr},
+		logger:    l,
+		repo:      repo,
+		storage:   storage,
+		evaluator: evaluator,
+		db:        db,
 	}
 }
 
 func (server *Server) RegisterHandler(config configuration.Config) {
 
 	metricHandler := handler.NewMetricHandler(server.logger, server.repo, config.Key)
+	ruleHandler := handler.NewRuleHandler(server.logger, server.storage, server.evaluator)
+	deliveryHandler := handler.NewDeliveryHandler(server.logger, server.storage)
+	silenceHandler := handler.NewSilenceHandler(server.logger, server.storage)
+	alertHandler := handler.NewAlertHandler(server.logger, server.evaluator, server.storage)
+	remoteWriteHandler := handler.NewRemoteWriteHandler(server.logger, server.repo)
+	otlpHandler := handler.NewOTLPHandler(server.logger, server.repo)
+	influxHandler := handler.NewInfluxHandler(server.logger, server.repo)
 
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
 		r.Use(middleware.RequestLogger(&handler.LogFormatter{Logger: server.logger}))
 		r.Use(handler.CheckHash(config.Key))
-		r.Use(middleware.Compress(5, "text/html", "application/json"))
+		r.Use(middleware.Compress(5, "text/html", "application/json", "text/plain", "application/openmetrics-text"))
 		r.Use(handler.Decompress(server.logger))
 		r.Use(middleware.Recoverer)
 		r.MethodFunc(http.MethodPost, "/update/{type}/{name}/{value}", metricHandler.SaveMetric)
 		r.MethodFunc(http.MethodGet, "/value/{type}/{name}", metricHandler.GetMetricByName)
 		r.MethodFunc(http.MethodGet, "/", metricHandler.GetAllMetrics)
+		r.MethodFunc(http.MethodGet, "/metrics", metricHandler.GetPrometheusMetrics)
+		r.MethodFunc(http.MethodPost, "/api/v1/write", remoteWriteHandler.Write)
+		r.MethodFunc(http.MethodPost, "/v1/metrics", otlpHandler.Export)
+		r.MethodFunc(http.MethodPost, "/write", influxHandler.Write)
 		r.MethodFunc(http.MethodPost, "/update/", metricHandler.SaveMetricWithJSON)
 		r.MethodFunc(http.MethodPost, "/updates/", metricHandler.SaveMetricsWithJSON)
 		r.MethodFunc(http.MethodPost, "/value/", metricHandler.GetMetricByNameWithJSON)
+		r.MethodFunc(http.MethodGet, "/history/{type}/{name}", metricHandler.GetHistoryByName)
+		r.MethodFunc(http.MethodPost, "/history/", metricHandler.GetHistoryWithJSON)
 		r.Method(http.MethodGet, "/ping", DBPing(server.logger, server.db))
+		r.Route("/api/rules", func(r chi.Router) {
+			r.MethodFunc(http.MethodGet, "/", ruleHandler.ListRules)
+			r.MethodFunc(http.MethodPost, "/", ruleHandler.CreateRule)
+			r.MethodFunc(http.MethodGet, "/{id}", ruleHandler.GetRule)
+			r.MethodFunc(http.MethodPut, "/{id}", ruleHandler.UpdateRule)
+			r.MethodFunc(http.MethodDelete, "/{id}", ruleHandler.DeleteRule)
+			r.MethodFunc(http.MethodPost, "/{id}/enable", ruleHandler.EnableRule)
+			r.MethodFunc(http.MethodPost, "/{id}/disable", ruleHandler.DisableRule)
+		})
+		r.Route("/api/deliveries", func(r chi.Router) {
+			r.MethodFunc(http.MethodGet, "/", deliveryHandler.ListDeliveries)
+			r.MethodFunc(http.MethodGet, "/{id}", deliveryHandler.GetDelivery)
+		})
+		r.Route("/api/silences", func(r chi.Router) {
+			r.MethodFunc(http.MethodGet, "/", silenceHandler.ListSilences)
+			r.MethodFunc(http.MethodPost, "/", silenceHandler.CreateSilence)
+			r.MethodFunc(http.MethodGet, "/{id}", silenceHandler.GetSilence)
+			r.MethodFunc(http.MethodPut, "/{id}", silenceHandler.UpdateSilence)
+			r.MethodFunc(http.MethodDelete, "/{id}", silenceHandler.DeleteSilence)
+		})
+		r.Route("/api/alerts", func(r chi.Router) {
+			r.MethodFunc(http.MethodGet, "/", alertHandler.ListAlerts)
+			r.MethodFunc(http.MethodGet, "/history", alertHandler.GetHistory)
+			r.MethodFunc(http.MethodPost, "/{id}/ack", alertHandler.AcknowledgeAlert)
+		})
 	})
 	server.server.Handler = r
 }
@@ -2,27 +2,60 @@ package configuration
 
 import (
 	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/DieOfCode/go-alert-service/internal/series"
 	"github.com/caarlos0/env/v6"
 )
 
 type Config struct {
-	ServerAddress   string `env:"ADDRESS"`
-	ReportInterval  int    `env:"REPORT_INTERVAL"`
-	PollInterval    int    `env:"POLL_INTERVAL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	Restore         *bool  `env:"RESTORE"`
-	StoreInterval   *int   `env:"STORE_INTERVAL"`
-	DatabaseDSN     string `env:"DATABASE_DSN"`
-	Key             string `env:"KEY"`
-	RateLimit       int    `env:"RATE_LIMIT"`
+	ServerAddress      string            `env:"ADDRESS"`
+	ReportInterval     int               `env:"REPORT_INTERVAL"`
+	PollInterval       int               `env:"POLL_INTERVAL"`
+	FileStoragePath    string            `env:"FILE_STORAGE_PATH"`
+	Restore            *bool             `env:"RESTORE"`
+	StoreInterval      *int              `env:"STORE_INTERVAL"`
+	DatabaseDSN        string            `env:"DATABASE_DSN"`
+	Key                string            `env:"KEY"`
+	RateLimit          int               `env:"RATE_LIMIT"`
+	Labels             map[string]string `env:"LABELS"`
+	SamplesLimit       *int              `env:"SAMPLES_LIMIT"`
+	HistoryLimit       int               `env:"ALERT_HISTORY_LIMIT"`
+	RetentionRaw       int               `env:"RETENTION_RAW_HOURS"`
+	RetentionMinute    int               `env:"RETENTION_MINUTE_DAYS"`
+	RetentionHour      int               `env:"RETENTION_HOUR_MONTHS"`
+	RollupInterval     int               `env:"ROLLUP_INTERVAL"`
+	AlertInterval      int               `env:"ALERT_INTERVAL"`
+	AlertRulesFile     string            `env:"ALERT_RULES_FILE"`
+	AlertRenotify      int               `env:"ALERT_RENOTIFY_INTERVAL"`
+	WebhookURL         string            `env:"NOTIFY_WEBHOOK_URL"`
+	NotifyFile         string            `env:"NOTIFY_FILE"`
+	SMTPAddress        string            `env:"SMTP_ADDRESS"`
+	SMTPUsername       string            `env:"SMTP_USERNAME"`
+	SMTPPassword       string            `env:"SMTP_PASSWORD"`
+	SMTPFrom           string            `env:"SMTP_FROM"`
+	SMTPTo             []string          `env:"SMTP_TO"`
+	NotifyAttempts     int               `env:"NOTIFY_ATTEMPTS"`
+	StatsDAddress      string            `env:"STATSD_ADDRESS"`
+	StatsDFlush        int               `env:"STATSD_FLUSH_INTERVAL"`
+	GraphiteAddress    string            `env:"GRAPHITE_ADDRESS"`
+	GRPCAddress        string            `env:"GRPC_ADDRESS"`
+	SpoolDir           string            `env:"SPOOL_DIR"`
+	SpoolMaxSize       int               `env:"SPOOL_MAX_SIZE"`
+	SpoolMaxAge        int               `env:"SPOOL_MAX_AGE"`
+	Collectors         []string          `env:"COLLECTORS"`
+	CollectorIntervals map[string]int    `env:"COLLECTOR_INTERVALS"`
 }
 
 func NewAgent() (*Config, error) {
 	flags := parseAgentFlags()
 
 	config := Config{}
-	if err := env.Parse(&config); err != nil {
+	if err := parseEnv(&config); err != nil {
 		return nil, err
 	}
 
@@ -41,6 +74,27 @@ func NewAgent() (*Config, error) {
 	if config.RateLimit == 0 {
 		config.RateLimit = flags.RateLimit
 	}
+	if len(config.Labels) == 0 {
+		config.Labels = flags.Labels
+	}
+	if config.GRPCAddress == "" {
+		config.GRPCAddress = flags.GRPCAddress
+	}
+	if config.SpoolDir == "" {
+		config.SpoolDir = flags.SpoolDir
+	}
+	if config.SpoolMaxSize == 0 {
+		config.SpoolMaxSize = flags.SpoolMaxSize
+	}
+	if config.SpoolMaxAge == 0 {
+		config.SpoolMaxAge = flags.SpoolMaxAge
+	}
+	if len(config.Collectors) == 0 {
+		config.Collectors = flags.Collectors
+	}
+	if len(config.CollectorIntervals) == 0 {
+		config.CollectorIntervals = flags.CollectorIntervals
+	}
 
 	return &config, nil
 }
@@ -49,7 +103,7 @@ func NewServer() (Config, error) {
 	flags := parseServerFlags()
 
 	config := Config{}
-	if err := env.Parse(&config); err != nil {
+	if err := parseEnv(&config); err != nil {
 		return Config{}, err
 	}
 
@@ -75,6 +129,78 @@ func NewServer() (Config, error) {
 	if config.RateLimit == 0 {
 		config.RateLimit = flags.RateLimit
 	}
+	if config.SamplesLimit == nil {
+		config.SamplesLimit = flags.SamplesLimit
+	}
+	if config.HistoryLimit == 0 {
+		config.HistoryLimit = flags.HistoryLimit
+	}
+	if config.RetentionRaw == 0 {
+		config.RetentionRaw = flags.RetentionRaw
+	}
+	if config.RetentionMinute == 0 {
+		config.RetentionMinute = flags.RetentionMinute
+	}
+	if config.RetentionHour == 0 {
+		config.RetentionHour = flags.RetentionHour
+	}
+	if config.RollupInterval == 0 {
+		config.RollupInterval = flags.RollupInterval
+	}
+	if config.AlertInterval == 0 {
+		config.AlertInterval = flags.AlertInterval
+	}
+	if config.AlertRulesFile == "" {
+		config.AlertRulesFile = flags.AlertRulesFile
+	}
+	if config.AlertRenotify == 0 {
+		config.AlertRenotify = flags.AlertRenotify
+	}
+	if config.WebhookURL == "" {
+		config.WebhookURL = flags.WebhookURL
+	}
+	if config.NotifyFile == "" {
+		config.NotifyFile = flags.NotifyFile
+	}
+	if config.SMTPAddress == "" {
+		config.SMTPAddress = flags.SMTPAddress
+	}
+	if config.SMTPUsername == "" {
+		config.SMTPUsername = flags.SMTPUsername
+	}
+	if config.SMTPPassword == "" {
+		config.SMTPPassword = flags.SMTPPassword
+	}
+	if config.SMTPFrom == "" {
+		config.SMTPFrom = flags.SMTPFrom
+	}
+	if len(config.SMTPTo) == 0 {
+		config.SMTPTo = flags.SMTPTo
+	}
+	if config.NotifyAttempts == 0 {
+		config.NotifyAttempts = flags.NotifyAttempts
+	}
+	if config.StatsDAddress == "" {
+		config.StatsDAddress = flags.StatsDAddress
+	}
+	if config.StatsDFlush == 0 {
+		config.StatsDFlush = flags.StatsDFlush
+	}
+	if config.GraphiteAddress == "" {
+		config.GraphiteAddress = flags.GraphiteAddress
+	}
+	if config.GRPCAddress == "" {
+		config.GRPCAddress = flags.GRPCAddress
+	}
+	if *config.SamplesLimit < 0 {
+		return Config{}, fmt.Errorf("invalid samples limit %d, it must not be negative", *config.SamplesLimit)
+	}
+	if config.NotifyAttempts < 1 {
+		return Config{}, fmt.Errorf("invalid notify attempts %d, at least one is required", config.NotifyAttempts)
+	}
+	if config.HistoryLimit < 0 {
+		return Config{}, fmt.Errorf("invalid alert history limit %d, it must not be negative", config.HistoryLimit)
+	}
 	if config.DatabaseDSN != "" {
 		config.FileStoragePath = ""
 		*config.StoreInterval = -1
@@ -84,20 +210,106 @@ func NewServer() (Config, error) {
 	return config, nil
 }
 
+// Retention converts the retention settings, negative values keep the data forever.
+func (c Config) Retention() series.Retention {
+	keep := func(n int, unit time.Duration) time.Duration {
+		if n <= 0 {
+			return 0
+		}
+		return time.Duration(n) * unit
+	}
+	return series.Retention{
+		Raw:    keep(c.RetentionRaw, time.Hour),
+		Minute: keep(c.RetentionMinute, 24*time.Hour),
+		Hour:   keep(c.RetentionHour, 30*24*time.Hour),
+	}
+}
+
 func parseAgentFlags() Config {
 	serverAddress := flag.String("a", "localhost:8080", "HTTP server endpoint address")
 	reportInterval := flag.Int("r", 10, "report interval to the server (in seconds)")
 	pollInterval := flag.Int("p", 2, "interval to gather metrics (in seconds)")
 	key := flag.String("k", "", "")
 	rateLimit := flag.Int("l", 1, "rate limit")
+	labels := flag.String("labels", "", "comma separated name:value labels added to every metric, e.g. host:web1,env:prod")
+	grpcAddress := flag.String("grpc-address", "", "gRPC server address to send the metrics to instead of POST /updates/")
+	spoolDir := flag.String("spool-dir", "", "directory to keep the unsent metrics in until the server accepts them, empty disables it")
+	spoolMaxSize := flag.Int("spool-max-size", 64, "size of the spool (in MiB), the oldest batches are dropped beyond it, negative disables the cap")
+	spoolMaxAge := flag.Int("spool-max-age", 86400, "age of the oldest batch in the spool (in seconds), negative disables the cap")
+	collectors := flag.String("collectors", "runtime,gopsutil,disk,net", "comma separated collectors to enable")
+	var collectorIntervals map[string]int
+	flag.Func("collector-intervals", "comma separated name:seconds poll intervals of collectors, e.g. gopsutil:10, the rest use -p", func(v string) (err error) {
+		collectorIntervals, err = parseIntervals(v)
+		return err
+	})
 	flag.Parse()
 	return Config{
-		ServerAddress:  *serverAddress,
-		ReportInterval: *reportInterval,
-		PollInterval:   *pollInterval,
-		Key:            *key,
-		RateLimit:      *rateLimit,
+		ServerAddress:      *serverAddress,
+		ReportInterval:     *reportInterval,
+		PollInterval:       *pollInterval,
+		Key:                *key,
+		RateLimit:          *rateLimit,
+		Labels:             parseLabels(*labels),
+		GRPCAddress:        *grpcAddress,
+		SpoolDir:           *spoolDir,
+		SpoolMaxSize:       *spoolMaxSize,
+		SpoolMaxAge:        *spoolMaxAge,
+		Collectors:         splitList(*collectors),
+		CollectorIntervals: collectorIntervals,
+	}
+}
+
+// parseEnv parses the environment, env has no parser for maps so they use
+// the flags format.
+func parseEnv(config *Config) error {
+	return env.ParseWithFuncs(config, map[reflect.Type]env.ParserFunc{
+		reflect.TypeOf(map[string]string(nil)): func(v string) (interface{}, error) {
+			return parseLabels(v), nil
+		},
+		reflect.TypeOf(map[string]int(nil)): func(v string) (interface{}, error) {
+			return parseIntervals(v)
+		},
+	})
+}
+
+// parseIntervals parses name:seconds pairs separated by commas.
+func parseIntervals(v string) (map[string]int, error) {
+	intervals := make(map[string]int)
+	for name, value := range parseLabels(v) {
+		interval, err := strconv.Atoi(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q of %s", value, name)
+		}
+		intervals[name] = interval
+	}
+	return intervals, nil
+}
+
+// splitList splits a comma separated list dropping the empty items.
+func splitList(v string) []string {
+	var res []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
 	}
+	return res
+}
+
+// parseLabels parses name:value pairs separated by commas, the format of -labels
+// and LABELS.
+func parseLabels(v string) map[string]string {
+	if v == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		name, value, _ := strings.Cut(pair, ":")
+		if name = strings.TrimSpace(name); name != "" {
+			labels[name] = strings.TrimSpace(value)
+		}
+	}
+	return labels
 }
 
 func parseServerFlags() Config {
@@ -106,9 +318,35 @@ func parseServerFlags() Config {
 	restore := flag.Bool("r", true, "restore")
 	storeInterval := flag.Int("i", 300, "interval")
 	databaseDSN := flag.String("d", "", "database DSN")
+	samplesLimit := flag.Int("samples-limit", 1000, "samples kept per series in memory, 0 disables them")
+	retentionRaw := flag.Int("retention-raw", 24, "hours to keep raw samples, negative keeps them forever")
+	retentionMinute := flag.Int("retention-minute", 30, "days to keep 1-minute rollups, negative keeps them forever")
+	retentionHour := flag.Int("retention-hour", 12, "months to keep 1-hour rollups, negative keeps them forever")
+	rollupInterval := flag.Int("rollup-interval", 60, "interval to compute rollups and delete expired data (in seconds)")
 	key := flag.String("k", "", "")
+	alertInterval := flag.Int("alert-interval", 10, "interval to evaluate alert rules (in seconds), negative disables alerting")
+	alertRulesFile := flag.String("alert-rules", "", "alert rules file path")
+	historyLimit := flag.Int("alert-history-limit", 10000, "alert history events kept by the in-memory storage, the oldest are dropped first, 0 keeps all of them")
+	alertRenotify := flag.Int("alert-renotify", 3600, "interval to repeat notifications of unacknowledged firing alerts (in seconds), negative disables it")
+	webhookURL := flag.String("notify-webhook", "", "URL to POST alert notifications to")
+	notifyFile := flag.String("notify-file", "", "file to append alert notifications to")
+	smtpAddress := flag.String("smtp-address", "", "SMTP server address for alert emails")
+	smtpUsername := flag.String("smtp-username", "", "SMTP username")
+	smtpPassword := flag.String("smtp-password", "", "SMTP password")
+	smtpFrom := flag.String("smtp-from", "", "sender of alert emails")
+	smtpTo := flag.String("smtp-to", "", "comma separated recipients of alert emails")
+	notifyAttempts := flag.Int("notify-attempts", 10, "attempts to deliver an alert notification before giving up")
+	statsdAddress := flag.String("statsd-address", "", "UDP address to receive StatsD metrics on, e.g. :8125, empty disables it")
+	statsdFlush := flag.Int("statsd-flush-interval", 10, "interval to store the aggregated StatsD metrics (in seconds)")
+	graphiteAddress := flag.String("graphite-address", "", "TCP address to receive Graphite plaintext metrics on, e.g. :2003, empty disables it")
+	grpcAddress := flag.String("grpc-address", "", "address to run the gRPC server on, e.g. :3200, empty disables it")
 	flag.Parse()
 
+	var recipients []string
+	if *smtpTo != "" {
+		recipients = strings.Split(*smtpTo, ",")
+	}
+
 	return Config{
 		ServerAddress:   *serverAddress,
 		FileStoragePath: *fileStoragePath,
@@ -116,5 +354,26 @@ func parseServerFlags() Config {
 		Restore:         restore,
 		StoreInterval:   storeInterval,
 		Key:             *key,
+		SamplesLimit:    samplesLimit,
+		HistoryLimit:    *historyLimit,
+		RetentionRaw:    *retentionRaw,
+		RetentionMinute: *retentionMinute,
+		RetentionHour:   *retentionHour,
+		RollupInterval:  *rollupInterval,
+		AlertInterval:   *alertInterval,
+		AlertRulesFile:  *alertRulesFile,
+		AlertRenotify:   *alertRenotify,
+		WebhookURL:      *webhookURL,
+		NotifyFile:      *notifyFile,
+		SMTPAddress:     *smtpAddress,
+		SMTPUsername:    *smtpUsername,
+		SMTPPassword:    *smtpPassword,
+		SMTPFrom:        *smtpFrom,
+		SMTPTo:          recipients,
+		NotifyAttempts:  *notifyAttempts,
+		StatsDAddress:   *statsdAddress,
+		StatsDFlush:     *statsdFlush,
+		GraphiteAddress: *graphiteAddress,
+		GRPCAddress:     *grpcAddress,
 	}
 }
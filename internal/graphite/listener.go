@@ -0,0 +1,155 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// batchSize is the number of metrics stored at once, smaller batches are
+	// stored every flushInterval.
+	batchSize     = 1000
+	flushInterval = time.Second
+)
+
+type Service interface {
+	SaveMetrics(m []metrics.Metric) error
+}
+
+// Listener receives Graphite plaintext lines over TCP and stores them in
+// batches.
+type Listener struct {
+	logger   *zerolog.Logger
+	service  Service
+	listener net.Listener
+
+	mu    sync.Mutex
+	batch []metrics.Metric
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// Listen opens the TCP socket, the connections are accepted once Serve is
+// called.
+func Listen(l *zerolog.Logger, addr string, srv Service) (*Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{
+		logger:   l,
+		service:  srv,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections until the context is done, then closes them and
+// stores the metrics received since the last flush.
+func (s *Listener) Serve(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.accept()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(flushInterval)
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-ctx.Done():
+			ticker.Stop()
+			s.listener.Close()
+			<-done
+			s.mu.Lock()
+			for conn := range s.conns {
+				conn.Close()
+			}
+			s.mu.Unlock()
+			s.wg.Wait()
+			s.Flush()
+			return
+		}
+	}
+}
+
+func (s *Listener) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Error().Err(err).Msg("Failed to accept Graphite connection")
+			}
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Listener) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		m, err := ParseLine(line)
+		if err != nil {
+			s.logger.Warn().Err(err).Msg("Invalid incoming data")
+			continue
+		}
+		if m != nil {
+			s.add(*m)
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger.Error().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("Failed to read Graphite connection")
+	}
+}
+
+func (s *Listener) add(m metrics.Metric) {
+	s.mu.Lock()
+	s.batch = append(s.batch, m)
+	full := len(s.batch) >= batchSize
+	s.mu.Unlock()
+
+	if full {
+		s.Flush()
+	}
+}
+
+// Flush stores the metrics received since the last flush.
+func (s *Listener) Flush() {
+	s.mu.Lock()
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.service.SaveMetrics(batch); err != nil {
+		s.logger.Error().Err(err).Int("metrics", len(batch)).Msg("Failed to store Graphite metrics")
+	}
+}
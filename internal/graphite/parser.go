@@ -0,0 +1,50 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+var ErrInvalidLine = errors.New("invalid graphite line")
+
+// ParseLine parses a plaintext line, path value timestamp, into a gauge.
+// Tagged paths, e.g. disk.used;host=web1;mount=/, have the tags as labels.
+// The timestamp is ignored, the metric is stored at the time it's received.
+// Lines with a NaN value, which collectd sends for unknown values, are
+// skipped and return nil.
+func ParseLine(s string) (*metrics.Metric, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("%w: %q must be path value [timestamp]", ErrInvalidLine, s)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: %q has an invalid value", ErrInvalidLine, s)
+	}
+	if math.IsNaN(value) {
+		return nil, nil
+	}
+
+	parts := strings.Split(fields[0], ";")
+	m := metrics.Metric{ID: parts[0], MType: metrics.TypeGauge, Value: &value}
+	if m.ID == "" {
+		return nil, fmt.Errorf("%w: %q has no path", ErrInvalidLine, s)
+	}
+	for _, tag := range parts[1:] {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" || v == "" {
+			return nil, fmt.Errorf("%w: %q has an invalid tag %q", ErrInvalidLine, s, tag)
+		}
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		m.Labels[k] = v
+	}
+	return &m, nil
+}
@@ -0,0 +1,100 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/pb"
+	"github.com/DieOfCode/go-alert-service/internal/signature"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func LogUnary(l *zerolog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		logCall(l, info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+func LogStream(l *zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(l, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func logCall(l *zerolog.Logger, method string, start time.Time, err error) {
+	l.Info().
+		Str("method", method).
+		Str("elapsed", time.Since(start).String()).
+		Str("code", status.Code(err).String()).
+		Msg("Request handled")
+}
+
+// CheckHashUnary verifies the signature of signed requests and signs the
+// responses when the server has a key. Requests without a signature are
+// accepted like by the HTTP API.
+func CheckHashUnary(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return handler(ctx, req)
+		}
+		if hash := metadata.ValueFromIncomingContext(ctx, pb.HashMetadata); len(hash) > 0 && hash[0] != "" {
+			if !signature.Equal(hash[0], signature.SignMessage(msg, key)) {
+				return nil, status.Error(codes.InvalidArgument, "Bad request")
+			}
+		}
+
+		res, err := handler(ctx, req)
+		if err != nil {
+			return res, err
+		}
+		if msg, ok := res.(proto.Message); ok {
+			grpc.SetHeader(ctx, metadata.Pairs(pb.HashMetadata, signature.SignMessage(msg, key)))
+		}
+		return res, nil
+	}
+}
+
+// CheckHashStream verifies the signature of every signed UpdateMetricsRequest
+// of the stream.
+func CheckHashStream(key string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if key == "" {
+			return handler(srv, ss)
+		}
+		return handler(srv, &checkedStream{ServerStream: ss, key: key})
+	}
+}
+
+type checkedStream struct {
+	grpc.ServerStream
+	key string
+}
+
+func (s *checkedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	req, ok := m.(*pb.UpdateMetricsRequest)
+	if !ok || req.GetHash() == "" {
+		return nil
+	}
+	if !signature.Equal(req.GetHash(), pb.SignUpdate(req, s.key)) {
+		return status.Error(codes.InvalidArgument, "Bad request")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/DieOfCode/go-alert-service/internal/handler"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/pb"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the gRPC API on top of the same service as the HTTP
+// handlers.
+type Server struct {
+	pb.UnimplementedMetricsServer
+	logger  *zerolog.Logger
+	service handler.Service
+}
+
+func New(l *zerolog.Logger, srv handler.Service) *Server {
+	return &Server{
+		logger:  l,
+		service: srv,
+	}
+}
+
+// NewGRPCServer returns a gRPC server with the API registered, the requests
+// are logged and checked against the key like the HTTP ones.
+func NewGRPCServer(l *zerolog.Logger, srv handler.Service, key string) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(LogUnary(l), CheckHashUnary(key)),
+		grpc.ChainStreamInterceptor(LogStream(l), CheckHashStream(key)),
+	)
+	pb.RegisterMetricsServer(s, New(l, srv))
+	return s
+}
+
+func (s *Server) UpdateMetrics(stream pb.Metrics_UpdateMetricsServer) error {
+	var stored int64
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&pb.UpdateMetricsResponse{Stored: stored})
+		}
+		if err != nil {
+			return err
+		}
+		if len(req.GetMetrics()) == 0 {
+			continue
+		}
+
+		ms := make([]metrics.Metric, 0, len(req.GetMetrics()))
+		for _, m := range req.GetMetrics() {
+			ms = append(ms, pb.ToMetric(m))
+		}
+		if err := s.service.SaveMetrics(ms); err != nil {
+			s.logger.Error().Err(err).Msg("SaveMetrics method error")
+			if errors.Is(err, repository.ErrParseMetric) {
+				return storedError(codes.InvalidArgument, err.Error(), stored)
+			}
+			return storedError(codes.Internal, "Internal server error", stored)
+		}
+		stored += int64(len(ms))
+	}
+}
+
+// storedError returns the error of a failed stream with the number of
+// metrics stored before it in the details, so the client retries only the
+// batches after them.
+func storedError(code codes.Code, msg string, stored int64) error {
+	st, err := status.New(code, msg).WithDetails(&pb.UpdateMetricsResponse{Stored: stored})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+func (s *Server) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.Metric, error) {
+	labels := req.GetLabels()
+	if len(labels) == 0 {
+		labels = nil
+	}
+	m, err := s.service.GetMetric(req.GetType(), req.GetId(), labels)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "Not found")
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("GetMetric method error")
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+	return pb.FromMetric(*m), nil
+}
+
+func (s *Server) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	data, err := s.service.GetMetrics()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("GetMetrics method error")
+		return nil, status.Error(codes.Internal, "Internal server error")
+	}
+
+	types := make([]string, 0, len(data))
+	for mtype := range data {
+		if req.GetType() == "" || req.GetType() == mtype {
+			types = append(types, mtype)
+		}
+	}
+	sort.Strings(types)
+
+	var res pb.ListMetricsResponse
+	for _, mtype := range types {
+		keys := make([]string, 0, len(data[mtype]))
+		for key := range data[mtype] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			res.Metrics = append(res.Metrics, pb.FromMetric(data[mtype][key]))
+		}
+	}
+	return &res, nil
+}
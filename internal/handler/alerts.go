@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/alert"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+type AlertService interface {
+	Alerts() []metrics.Alert
+	Acknowledge(ruleID, by, comment string, now time.Time) (*metrics.Alert, error)
+}
+
+type AlertHandler struct {
+	logger  *zerolog.Logger
+	service AlertService
+	history repository.HistoryStorage
+}
+
+type ackRequest struct {
+	By      string `json:"by"`
+	Comment string `json:"comment"`
+}
+
+func NewAlertHandler(l *zerolog.Logger, srv AlertService, history repository.HistoryStorage) *AlertHandler {
+	return &AlertHandler{
+		logger:  l,
+		service: srv,
+		history: history,
+	}
+}
+
+// list current alert states
+func (h *AlertHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, h.service.Alerts())
+}
+
+// acknowledge alert
+func (h *AlertHandler) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	var req ackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	if req.By == "" {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "by is required"})
+		return
+	}
+
+	a, err := h.service.Acknowledge(chi.URLParam(r, "id"), req.By, req.Comment, time.Now())
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	case errors.Is(err, alert.ErrNotActive):
+		writeResponse(w, http.StatusConflict, metrics.Error{Error: err.Error()})
+		return
+	case err != nil:
+		h.logger.Error().Err(err).Msg("Acknowledge method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	writeResponse(w, http.StatusOK, a)
+}
+
+// get alert history, filtered by ?rule= and the ?from= and ?to= RFC 3339 times
+func (h *AlertHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	events, err := h.history.LoadEvents(r.URL.Query().Get("rule"), from, to)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadEvents method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	if events == nil {
+		events = []metrics.AlertEvent{}
+	}
+
+	writeResponse(w, http.StatusOK, events)
+}
+
+// parseTimeRange reads the ?from= and ?to= RFC 3339 query parameters, to
+// defaults to now.
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	var from time.Time
+	to := time.Now()
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, err
+		}
+		from = t
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, err
+		}
+		to = t
+	}
+	return from, to, nil
+}
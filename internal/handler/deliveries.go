@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+type DeliveryHandler struct {
+	logger  *zerolog.Logger
+	storage repository.DeliveryStorage
+}
+
+func NewDeliveryHandler(l *zerolog.Logger, storage repository.DeliveryStorage) *DeliveryHandler {
+	return &DeliveryHandler{
+		logger:  l,
+		storage: storage,
+	}
+}
+
+// list notification deliveries, optionally filtered by ?status=
+func (h *DeliveryHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", metrics.DeliveryPending, metrics.DeliverySent, metrics.DeliveryFailed:
+	default:
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	deliveries, err := h.storage.LoadDeliveries(status)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadDeliveries method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	if deliveries == nil {
+		deliveries = []metrics.Delivery{}
+	}
+
+	writeResponse(w, http.StatusOK, deliveries)
+}
+
+// get notification delivery
+func (h *DeliveryHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	d, err := h.storage.LoadDelivery(chi.URLParam(r, "id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadDelivery method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	writeResponse(w, http.StatusOK, d)
+}
@@ -6,12 +6,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
 	"text/template"
+	"time"
 
+	"github.com/DieOfCode/go-alert-service/internal/ingest"
 	"github.com/DieOfCode/go-alert-service/internal/metrics"
 	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/DieOfCode/go-alert-service/internal/series"
+	"github.com/DieOfCode/go-alert-service/internal/signature"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 )
@@ -19,20 +25,27 @@ import (
 type Service interface {
 	SaveMetric(m metrics.Metric) error
 	SaveMetrics(m []metrics.Metric) error
-	GetMetric(mtype, mname string) (*metrics.Metric, error)
+	GetMetric(mtype, mname string, labels map[string]string) (*metrics.Metric, error)
 	GetMetrics() (metrics.Data, error)
+	GetHistory(q metrics.RangeQuery) (*metrics.History, error)
 }
 
 type MetricHandler interface {
 	GetMetricByName(w http.ResponseWriter, r *http.Request)
 	GetMetricByNameWithJSON(w http.ResponseWriter, r *http.Request)
+	GetHistoryByName(w http.ResponseWriter, r *http.Request)
+	GetHistoryWithJSON(w http.ResponseWriter, r *http.Request)
 	GetAllMetrics(w http.ResponseWriter, r *http.Request)
+	GetPrometheusMetrics(w http.ResponseWriter, r *http.Request)
 	SaveMetric(w http.ResponseWriter, r *http.Request)
 	SaveMetricWithJSON(w http.ResponseWriter, r *http.Request)
 	SaveMetricsWithJSON(w http.ResponseWriter, r *http.Request)
 	DBPing(db *sql.DB) Handler
 }
 
+// defaultHistoryRange is the range of history queries without from.
+const defaultHistoryRange = time.Hour
+
 type Handler struct {
 	logger  *zerolog.Logger
 	service Service
@@ -52,7 +65,7 @@ func (h *Handler) GetMetricByName(w http.ResponseWriter, r *http.Request) {
 	mtype := chi.URLParam(r, "type")
 	mname := chi.URLParam(r, "name")
 
-	metric, err := h.service.GetMetric(mtype, mname)
+	metric, err := h.service.GetMetric(mtype, mname, queryLabels(r, "quantile"))
 	if err != nil {
 		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
 		return
@@ -60,16 +73,43 @@ func (h *Handler) GetMetricByName(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info().Any("metric", metric).Msg("Received metric from storage")
 
 	if h.key != "" {
-		w.Header().Add("HashSHA256", sign(metric, h.key))
+		w.Header().Add("HashSHA256", signature.Sign(metric, h.key))
 	}
 	switch mtype {
 	case metrics.TypeGauge:
 		writeResponse(w, http.StatusOK, *metric.Value)
 	case metrics.TypeCounter:
 		writeResponse(w, http.StatusOK, *metric.Delta)
+	case metrics.TypeHistogram:
+		writeQuantile(w, r, metric.Histogram, metric.Histogram.WithQuantiles(metrics.DefaultQuantiles))
+	case metrics.TypeSummary:
+		writeQuantile(w, r, metric.Summary, metric.Summary.WithQuantiles(metrics.DefaultQuantiles))
+	case metrics.TypeSet:
+		writeResponse(w, http.StatusOK, metric.Set.Estimate())
 	}
 }
 
+// writeQuantile responds with the estimate of the quantile query parameter,
+// with the whole distribution if there is none.
+func writeQuantile(w http.ResponseWriter, r *http.Request, d interface{ Quantile(q float64) float64 }, all any) {
+	q := r.URL.Query().Get("quantile")
+	if q == "" {
+		writeResponse(w, http.StatusOK, all)
+		return
+	}
+	quantile, err := strconv.ParseFloat(q, 64)
+	if err != nil || quantile < 0 || quantile > 1 {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	v := d.Quantile(quantile)
+	if math.IsNaN(v) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	}
+	writeResponse(w, http.StatusOK, v)
+}
+
 // get metric with json
 func (h *Handler) GetMetricByNameWithJSON(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info().Any("req", r.Body).Msg("Request body")
@@ -82,19 +122,162 @@ func (h *Handler) GetMetricByNameWithJSON(w http.ResponseWriter, r *http.Request
 	}
 	h.logger.Info().Any("req", req).Msg("Decoded request body")
 
-	res, err := h.service.GetMetric(req.MType, req.ID)
+	res, err := h.service.GetMetric(req.MType, req.ID, req.Labels)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("GetMetric method error")
 		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
 		return
 	}
+	if res.Histogram != nil {
+		res.Histogram = res.Histogram.WithQuantiles(metrics.DefaultQuantiles)
+	}
+	if res.Summary != nil {
+		res.Summary = res.Summary.WithQuantiles(metrics.DefaultQuantiles)
+	}
+	if res.Set != nil {
+		res.Set = res.Set.WithCardinality()
+	}
+
+	if h.key != "" {
+		w.Header().Add("HashSHA256", signature.Sign(res, h.key))
+	}
+	writeResponse(w, http.StatusOK, res)
+}
+
+type historyRequest struct {
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Step   string            `json:"step"`
+	Agg    string            `json:"agg"`
+}
+
+// get metric history
+func (h *Handler) GetHistoryByName(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	if r.URL.Query().Get("from") == "" {
+		from = to.Add(-defaultHistoryRange)
+	}
+	step, err := parseStep(r.URL.Query().Get("step"))
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	h.getHistory(w, metrics.RangeQuery{
+		ID:     chi.URLParam(r, "name"),
+		MType:  chi.URLParam(r, "type"),
+		Labels: queryLabels(r, "from", "to", "step", "agg"),
+		From:   from,
+		To:     to,
+		Step:   step,
+		Agg:    r.URL.Query().Get("agg"),
+	})
+}
+
+// get metric history with json
+func (h *Handler) GetHistoryWithJSON(w http.ResponseWriter, r *http.Request) {
+	var req historyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	h.logger.Info().Any("req", req).Msg("Decoded request body")
+
+	step, err := parseStep(req.Step)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if req.From.IsZero() {
+		req.From = req.To.Add(-defaultHistoryRange)
+	}
+
+	h.getHistory(w, metrics.RangeQuery{
+		ID:     req.ID,
+		MType:  req.MType,
+		Labels: req.Labels,
+		From:   req.From,
+		To:     req.To,
+		Step:   step,
+		Agg:    req.Agg,
+	})
+}
+
+func (h *Handler) getHistory(w http.ResponseWriter, q metrics.RangeQuery) {
+	if q.Agg == "" {
+		q.Agg = series.DefaultAgg(q.MType)
+	}
+	if err := series.Validate(q); err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	if _, err := h.service.GetMetric(q.MType, q.ID, q.Labels); err != nil {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	}
+
+	res, err := h.service.GetHistory(q)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("GetHistory method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
 
 	if h.key != "" {
-		w.Header().Add("HashSHA256", sign(res, h.key))
+		w.Header().Add("HashSHA256", signature.Sign(res, h.key))
 	}
 	writeResponse(w, http.StatusOK, res)
 }
 
+// lookup reads the stored series for the ingest converters.
+func lookup(srv Service) ingest.Lookup {
+	return func(mtype, mname string, labels map[string]string) *metrics.Metric {
+		m, err := srv.GetMetric(mtype, mname, labels)
+		if err != nil {
+			return nil
+		}
+		return m
+	}
+}
+
+// queryLabels returns the query parameters except the reserved ones as the
+// series labels, e.g. /value/gauge/HeapAlloc?host=a.
+func queryLabels(r *http.Request, reserved ...string) map[string]string {
+	var labels map[string]string
+	for name, values := range r.URL.Query() {
+		if slices.Contains(reserved, name) || len(values) == 0 {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[name] = values[0]
+	}
+	return labels
+}
+
+// parseStep accepts a number of seconds or a duration like 5m, empty means no aggregation.
+func parseStep(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(v)
+}
+
 // get all metrics
 func (h *Handler) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
 	allMetrics, err := h.service.GetMetrics()
@@ -116,7 +299,7 @@ func (h *Handler) GetAllMetrics(w http.ResponseWriter, r *http.Request) {
 
 	}
 	if h.key != "" {
-		w.Header().Add("HashSHA256", sign(allMetrics, h.key))
+		w.Header().Add("HashSHA256", signature.Sign(allMetrics, h.key))
 	}
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
@@ -133,7 +316,7 @@ const HTMLTemplateString = `
     <h1>Metrics</h1>
     <ul>
     {{range .}}{{range .}}
-        <li>ID: {{.ID}}, Value: {{.Value}}, Delta: {{.Delta}}</li>
+        <li>ID: {{.Key}}, Value: {{.Value}}, Delta: {{.Delta}}{{with .Histogram}}, Count: {{.Count}}, Sum: {{.Sum}}{{end}}{{with .Summary}}, Count: {{.Count}}, Sum: {{.Sum}}{{end}}{{with .Set}}, Cardinality: {{.Estimate}}{{end}}</li>
     {{end}}{{end}}
     </ul>
 </body>
@@ -146,7 +329,7 @@ func (h *Handler) SaveMetric(w http.ResponseWriter, r *http.Request) {
 	mname := chi.URLParam(r, "name")
 	mvalue := chi.URLParam(r, "value")
 
-	if mtype != metrics.TypeCounter && mtype != metrics.TypeGauge {
+	if mtype != metrics.TypeCounter && mtype != metrics.TypeGauge && mtype != metrics.TypeHistogram && mtype != metrics.TypeSummary && mtype != metrics.TypeSet {
 		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
 		return
 	}
@@ -161,9 +344,10 @@ func (h *Handler) SaveMetric(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		m = metrics.Metric{
-			ID:    mname,
-			MType: mtype,
-			Delta: &delta,
+			ID:     mname,
+			MType:  mtype,
+			Delta:  &delta,
+			Labels: queryLabels(r),
 		}
 	case metrics.TypeGauge:
 		value, err := strconv.ParseFloat(mvalue, 64)
@@ -172,9 +356,51 @@ func (h *Handler) SaveMetric(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		m = metrics.Metric{
-			ID:    mname,
-			MType: mtype,
-			Value: &value,
+			ID:     mname,
+			MType:  mtype,
+			Value:  &value,
+			Labels: queryLabels(r),
+		}
+	case metrics.TypeHistogram:
+		value, err := strconv.ParseFloat(mvalue, 64)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+			return
+		}
+		// a single observation goes to the buckets of the stored series
+		bounds := metrics.DefaultBuckets
+		if stored, err := h.service.GetMetric(mtype, mname, queryLabels(r)); err == nil && stored.Histogram != nil {
+			bounds = stored.Histogram.Bounds
+		}
+		histogram := metrics.NewHistogram(bounds)
+		if err := histogram.Observe(value); err != nil {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+			return
+		}
+		m = metrics.Metric{
+			ID:        mname,
+			MType:     mtype,
+			Histogram: histogram,
+			Labels:    queryLabels(r),
+		}
+	case metrics.TypeSummary:
+		value, err := strconv.ParseFloat(mvalue, 64)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+			return
+		}
+		m = metrics.Metric{
+			ID:           mname,
+			MType:        mtype,
+			Observations: []float64{value},
+			Labels:       queryLabels(r),
+		}
+	case metrics.TypeSet:
+		m = metrics.Metric{
+			ID:      mname,
+			MType:   mtype,
+			Members: []string{mvalue},
+			Labels:  queryLabels(r),
 		}
 	}
 
@@ -203,6 +429,10 @@ func (h *Handler) SaveMetricWithJSON(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.service.SaveMetric(req); err != nil {
 		h.logger.Error().Err(err).Msg("SaveMetric method error")
+		if errors.Is(err, repository.ErrParseMetric) {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+			return
+		}
 		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
 		return
 	}
@@ -221,6 +451,10 @@ func (h *Handler) SaveMetricsWithJSON(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.service.SaveMetrics(req); err != nil {
 		h.logger.Error().Err(err).Msg("SaveMetric method error")
+		if errors.Is(err, repository.ErrParseMetric) {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+			return
+		}
 		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
 		return
 	}
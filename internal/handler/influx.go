@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/DieOfCode/go-alert-service/internal/ingest"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+type InfluxHandler struct {
+	logger  *zerolog.Logger
+	service Service
+}
+
+func NewInfluxHandler(l *zerolog.Logger, srv Service) *InfluxHandler {
+	return &InfluxHandler{
+		logger:  l,
+		service: srv,
+	}
+}
+
+// receive InfluxDB line protocol writes
+func (h *InfluxHandler) Write(w http.ResponseWriter, r *http.Request) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	// the valid lines are stored even if others can't be parsed
+	ms, parseErr := ingest.ParseLineProtocol(b)
+	if parseErr != nil {
+		h.logger.Error().Err(parseErr).Msg("Invalid incoming data")
+	}
+	if len(ms) > 0 {
+		if err := h.service.SaveMetrics(ms); err != nil {
+			h.logger.Error().Err(err).Msg("SaveMetrics method error")
+			if errors.Is(err, repository.ErrParseMetric) {
+				writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+				return
+			}
+			writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+			return
+		}
+	}
+	if parseErr != nil {
+		// clients drop the batch instead of retrying it on client errors
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "partial write: " + parseErr.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/DieOfCode/go-alert-service/internal/ingest"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+)
+
+type OTLPHandler struct {
+	logger    *zerolog.Logger
+	service   Service
+	converter *ingest.OTLP
+}
+
+func NewOTLPHandler(l *zerolog.Logger, srv Service) *OTLPHandler {
+	return &OTLPHandler{
+		logger:    l,
+		service:   srv,
+		converter: ingest.NewOTLP(),
+	}
+}
+
+// receive OTLP/HTTP metrics export requests
+func (h *OTLPHandler) Export(w http.ResponseWriter, r *http.Request) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != ingest.ContentTypeProtobuf && contentType != ingest.ContentTypeJSON) {
+		writeResponse(w, http.StatusUnsupportedMediaType, metrics.Error{Error: "OTLP body must be application/x-protobuf or application/json"})
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	req, err := ingest.DecodeOTLP(b, contentType)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	converted, err := h.converter.Store(req, lookup(h.service), h.service.SaveMetrics)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("SaveMetrics method error")
+		if errors.Is(err, repository.ErrParseMetric) {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+			return
+		}
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	var res colmetricspb.ExportMetricsServiceResponse
+	if converted.Rejected > 0 {
+		h.logger.Warn().Int64("rejected", converted.Rejected).Msg(converted.Reason)
+		res.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: converted.Rejected,
+			ErrorMessage:       converted.Reason,
+		}
+	}
+	body, err := ingest.EncodeOTLP(&res, contentType)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("EncodeOTLP method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
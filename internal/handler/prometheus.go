@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+const (
+	// ContentTypePrometheus is the Prometheus text exposition format.
+	ContentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+	// ContentTypeOpenMetrics is the OpenMetrics text format.
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// get all metrics in the Prometheus text format
+func (h *Handler) GetPrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	contentType, ok := negotiateExposition(r.Header.Get("Accept"))
+	if !ok {
+		writeResponse(w, http.StatusNotAcceptable, metrics.Error{Error: "Not acceptable"})
+		return
+	}
+
+	allMetrics, err := h.service.GetMetrics()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("GetMetrics method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	var buf bytes.Buffer
+	openMetrics := contentType == ContentTypeOpenMetrics
+	for _, f := range families(allMetrics) {
+		if f.conflict {
+			h.logger.Warn().Str("name", f.name).Msg("Metric name is used by several types, only the first one is exposed")
+		}
+		if f.collisions > 0 {
+			h.logger.Warn().Str("name", f.name).Int("series", f.collisions).Msg("Series have the same name and labels after sanitizing, only the first one is exposed")
+		}
+		writeFamily(&buf, f, openMetrics)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// negotiateExposition picks the format preferred by the Accept header,
+// the Prometheus text format unless OpenMetrics has a higher quality.
+func negotiateExposition(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return ContentTypePrometheus, true
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var contentType string
+		switch mediaType {
+		case "application/openmetrics-text":
+			contentType = ContentTypeOpenMetrics
+		case "text/plain", "text/*", "*/*":
+			contentType = ContentTypePrometheus
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	return best, best != ""
+}
+
+type family struct {
+	name  string
+	mtype string
+	// series are ordered by their key
+	series []metrics.Metric
+	// conflict is set when metrics of other types have the same name
+	conflict bool
+	// total is set for counters named with the _total suffix
+	total bool
+	// collisions counts the skipped series exposed like one of series, e.g.
+	// foo and foo_total or a.b and a_b
+	collisions int
+	seen       map[string]bool
+}
+
+// families groups the series by the sanitized metric name.
+func families(data metrics.Data) []*family {
+	byName := make(map[string]*family)
+	// types are visited in order so a name conflict always resolves the same way
+	types := make([]string, 0, len(data))
+	for mtype := range data {
+		types = append(types, mtype)
+	}
+	sort.Strings(types)
+
+	for _, mtype := range types {
+		// and so are the series, the first one wins a collision
+		keys := make([]string, 0, len(data[mtype]))
+		for key := range data[mtype] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			m := data[mtype][key]
+			name := metricName(m.ID)
+			var total bool
+			if m.MType == metrics.TypeCounter {
+				// OpenMetrics appends the suffix to the samples of the family
+				name, total = strings.CutSuffix(name, "_total")
+			}
+			f, ok := byName[name]
+			if !ok {
+				f = &family{name: name, mtype: mtype, total: total, seen: make(map[string]bool)}
+				byName[name] = f
+			}
+			if f.mtype != mtype {
+				f.conflict = true
+				continue
+			}
+			signature := labelsSignature(m.Labels)
+			if f.total != total || f.seen[signature] {
+				f.collisions++
+				continue
+			}
+			f.seen[signature] = true
+			f.series = append(f.series, m)
+		}
+	}
+
+	res := make([]*family, 0, len(byName))
+	for _, f := range byName {
+		sort.Slice(f.series, func(i, j int) bool { return f.series[i].Key() < f.series[j].Key() })
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].name < res[j].name })
+	return res
+}
+
+// labelsSignature identifies the series of a family by the labels as they are
+// exposed.
+func labelsSignature(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, labelName(name)+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\xff")
+}
+
+func writeFamily(buf *bytes.Buffer, f *family, openMetrics bool) {
+	switch f.mtype {
+	case metrics.TypeCounter:
+		name := f.name
+		if openMetrics || f.total {
+			name += "_total"
+		}
+		if openMetrics {
+			fmt.Fprintf(buf, "# TYPE %s counter\n", f.name)
+		} else {
+			fmt.Fprintf(buf, "# TYPE %s counter\n", name)
+		}
+		for _, m := range f.series {
+			if m.Delta != nil {
+				writeSample(buf, name, m.Labels, float64(*m.Delta))
+			}
+		}
+	case metrics.TypeGauge:
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", f.name)
+		for _, m := range f.series {
+			if m.Value != nil {
+				writeSample(buf, f.name, m.Labels, *m.Value)
+			}
+		}
+	case metrics.TypeHistogram:
+		fmt.Fprintf(buf, "# TYPE %s histogram\n", f.name)
+		for _, m := range f.series {
+			if m.Histogram == nil {
+				continue
+			}
+			var cumulative uint64
+			for i, c := range m.Histogram.Counts {
+				cumulative += c
+				le := math.Inf(1)
+				if i < len(m.Histogram.Bounds) {
+					le = m.Histogram.Bounds[i]
+				}
+				writeSample(buf, f.name+"_bucket", withLabel(m.Labels, "le", formatFloat(le)), float64(cumulative))
+			}
+			writeSample(buf, f.name+"_sum", m.Labels, m.Histogram.Sum)
+			writeSample(buf, f.name+"_count", m.Labels, float64(m.Histogram.Count))
+		}
+	case metrics.TypeSummary:
+		fmt.Fprintf(buf, "# TYPE %s summary\n", f.name)
+		for _, m := range f.series {
+			if m.Summary == nil {
+				continue
+			}
+			for _, q := range metrics.DefaultQuantiles {
+				if v := m.Summary.Quantile(q); !math.IsNaN(v) {
+					writeSample(buf, f.name, withLabel(m.Labels, "quantile", formatFloat(q)), v)
+				}
+			}
+			writeSample(buf, f.name+"_sum", m.Labels, m.Summary.Sum)
+			writeSample(buf, f.name+"_count", m.Labels, float64(m.Summary.Count))
+		}
+	case metrics.TypeSet:
+		// the distinct count is an estimate, not a running total of increments
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", f.name)
+		for _, m := range f.series {
+			if m.Set != nil {
+				writeSample(buf, f.name, m.Labels, float64(m.Set.Estimate()))
+			}
+		}
+	}
+}
+
+func writeSample(buf *bytes.Buffer, name string, labels map[string]string, v float64) {
+	buf.WriteString(name)
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for label := range labels {
+			names = append(names, label)
+		}
+		sort.Strings(names)
+		buf.WriteByte('{')
+		for i, label := range names {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			fmt.Fprintf(buf, `%s="%s"`, labelName(label), escapeLabelValue(labels[label]))
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatFloat(v))
+	buf.WriteByte('\n')
+}
+
+// withLabel returns a copy of the labels with one more label.
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	res := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		res[k] = v
+	}
+	res[name] = value
+	return res
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricName replaces the characters Prometheus doesn't allow in metric names.
+func metricName(id string) string {
+	return sanitizeName(id, true)
+}
+
+// labelName replaces the characters Prometheus doesn't allow in label names.
+func labelName(name string) string {
+	return sanitizeName(name, false)
+}
+
+func sanitizeName(name string, colons bool) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', colons && c == ':':
+			b.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(c)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/DieOfCode/go-alert-service/internal/ingest"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+type RemoteWriteHandler struct {
+	logger    *zerolog.Logger
+	service   Service
+	converter *ingest.RemoteWrite
+}
+
+func NewRemoteWriteHandler(l *zerolog.Logger, srv Service) *RemoteWriteHandler {
+	return &RemoteWriteHandler{
+		logger:    l,
+		service:   srv,
+		converter: ingest.NewRemoteWrite(),
+	}
+}
+
+// receive Prometheus remote_write requests
+func (h *RemoteWriteHandler) Write(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Encoding") != "snappy" {
+		writeResponse(w, http.StatusUnsupportedMediaType, metrics.Error{Error: "remote_write body must be snappy encoded"})
+		return
+	}
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+
+	req, err := ingest.DecodeWriteRequest(b)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	err = h.converter.Store(req, lookup(h.service), h.service.SaveMetrics)
+	if errors.Is(err, ingest.ErrInvalidRequest) || errors.Is(err, ingest.ErrUnsupportedSamples) {
+		// Prometheus drops the batch on client errors instead of retrying it
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("SaveMetrics method error")
+		if errors.Is(err, repository.ErrParseMetric) {
+			writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+			return
+		}
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/alert"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+// RuleAlerts drops the alert state of the rules that are disabled, deleted or
+// changed.
+type RuleAlerts interface {
+	Retire(rule metrics.AlertRule, now time.Time)
+}
+
+type RuleHandler struct {
+	logger  *zerolog.Logger
+	storage repository.RuleStorage
+	alerts  RuleAlerts
+}
+
+func NewRuleHandler(l *zerolog.Logger, storage repository.RuleStorage, alerts RuleAlerts) *RuleHandler {
+	return &RuleHandler{
+		logger:  l,
+		storage: storage,
+		alerts:  alerts,
+	}
+}
+
+// list rules
+func (h *RuleHandler) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.storage.LoadRules()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadRules method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	if rules == nil {
+		rules = []metrics.AlertRule{}
+	}
+
+	writeResponse(w, http.StatusOK, rules)
+}
+
+// get rule
+func (h *RuleHandler) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.loadRule(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	writeResponse(w, http.StatusOK, rule)
+}
+
+// create rule
+func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var req metrics.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	if req.ID == "" {
+		req.ID = metrics.NewID()
+	}
+
+	_, err := h.storage.LoadRule(req.ID)
+	if err == nil {
+		writeResponse(w, http.StatusConflict, metrics.Error{Error: "Rule already exists"})
+		return
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		h.logger.Error().Err(err).Msg("LoadRule method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	h.storeRule(w, http.StatusCreated, req, nil)
+}
+
+// update rule
+func (h *RuleHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	old, ok := h.loadRule(w, id)
+	if !ok {
+		return
+	}
+
+	var req metrics.AlertRule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	req.ID = id
+
+	h.storeRule(w, http.StatusOK, req, old)
+}
+
+// enable rule
+func (h *RuleHandler) EnableRule(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, chi.URLParam(r, "id"), false)
+}
+
+// disable rule
+func (h *RuleHandler) DisableRule(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, chi.URLParam(r, "id"), true)
+}
+
+// delete rule
+func (h *RuleHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.loadRule(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	err := h.storage.DeleteRule(rule.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("DeleteRule method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	h.alerts.Retire(*rule, time.Now())
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *RuleHandler) setDisabled(w http.ResponseWriter, id string, disabled bool) {
+	old, ok := h.loadRule(w, id)
+	if !ok {
+		return
+	}
+	rule := *old
+	rule.Disabled = disabled
+
+	h.storeRule(w, http.StatusOK, rule, old)
+}
+
+func (h *RuleHandler) loadRule(w http.ResponseWriter, id string) (*metrics.AlertRule, bool) {
+	rule, err := h.storage.LoadRule(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadRule method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return nil, false
+	}
+	return rule, true
+}
+
+// storeRule stores the rule replacing old, nil for a new rule.
+func (h *RuleHandler) storeRule(w http.ResponseWriter, code int, rule metrics.AlertRule, old *metrics.AlertRule) {
+	if err := alert.Validate(rule); err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	if err := h.storage.StoreRule(rule); err != nil {
+		h.logger.Error().Err(err).Msg("StoreRule method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	h.logger.Info().Any("rule", rule).Msg("Rule is stored")
+	// the state of the old rule is resolved with the series it was about
+	if old != nil && (rule.Disabled || alert.Changed(*old, rule)) {
+		h.alerts.Retire(*old, time.Now())
+	}
+
+	writeResponse(w, code, rule)
+}
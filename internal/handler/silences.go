@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/alert"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+)
+
+type SilenceHandler struct {
+	logger  *zerolog.Logger
+	storage repository.SilenceStorage
+}
+
+func NewSilenceHandler(l *zerolog.Logger, storage repository.SilenceStorage) *SilenceHandler {
+	return &SilenceHandler{
+		logger:  l,
+		storage: storage,
+	}
+}
+
+// list silences, only the ones in effect with ?active=true
+func (h *SilenceHandler) ListSilences(w http.ResponseWriter, r *http.Request) {
+	silences, err := h.storage.LoadSilences()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadSilences method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	res := []metrics.Silence{}
+	now := time.Now()
+	for _, s := range silences {
+		if r.URL.Query().Get("active") == "true" && !alert.Active(s, now) {
+			continue
+		}
+		res = append(res, s)
+	}
+
+	writeResponse(w, http.StatusOK, res)
+}
+
+// get silence
+func (h *SilenceHandler) GetSilence(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.loadSilence(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	writeResponse(w, http.StatusOK, s)
+}
+
+// create silence
+func (h *SilenceHandler) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	var req metrics.Silence
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	req.ID = metrics.NewID()
+	req.CreatedAt = time.Now()
+	if req.StartsAt.IsZero() {
+		req.StartsAt = req.CreatedAt
+	}
+
+	h.storeSilence(w, http.StatusCreated, req)
+}
+
+// update silence
+func (h *SilenceHandler) UpdateSilence(w http.ResponseWriter, r *http.Request) {
+	current, ok := h.loadSilence(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	var req metrics.Silence
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Invalid incoming data")
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: "Bad request"})
+		return
+	}
+	req.ID = current.ID
+	req.CreatedAt = current.CreatedAt
+	if req.StartsAt.IsZero() {
+		req.StartsAt = current.StartsAt
+	}
+
+	h.storeSilence(w, http.StatusOK, req)
+}
+
+// delete silence
+func (h *SilenceHandler) DeleteSilence(w http.ResponseWriter, r *http.Request) {
+	err := h.storage.DeleteSilence(chi.URLParam(r, "id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("DeleteSilence method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SilenceHandler) loadSilence(w http.ResponseWriter, id string) (*metrics.Silence, bool) {
+	s, err := h.storage.LoadSilence(id)
+	if errors.Is(err, repository.ErrNotFound) {
+		writeResponse(w, http.StatusNotFound, metrics.Error{Error: "Not found"})
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("LoadSilence method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return nil, false
+	}
+	return s, true
+}
+
+func (h *SilenceHandler) storeSilence(w http.ResponseWriter, code int, s metrics.Silence) {
+	if err := alert.ValidateSilence(s); err != nil {
+		writeResponse(w, http.StatusBadRequest, metrics.Error{Error: err.Error()})
+		return
+	}
+	if err := h.storage.StoreSilence(s); err != nil {
+		h.logger.Error().Err(err).Msg("StoreSilence method error")
+		writeResponse(w, http.StatusInternalServerError, metrics.Error{Error: "Internal server error"})
+		return
+	}
+	h.logger.Info().Any("silence", s).Msg("Silence is stored")
+
+	writeResponse(w, code, s)
+}
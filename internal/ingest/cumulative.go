@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"math"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// Lookup returns the stored series, nil if there is none. Converters use it
+// for the series they haven't seen before, e.g. after a restart.
+type Lookup func(mtype, mname string, labels map[string]string) *metrics.Metric
+
+// Save stores the converted metrics.
+type Save func([]metrics.Metric) error
+
+type cumulativeSeries struct {
+	last float64
+	// rem is the fraction of the increases not stored yet
+	rem float64
+}
+
+// cumulative turns the cumulative values of counters into the deltas the
+// server stores by remembering the last value of every series. The changes
+// are pending until commit, so a request retried after a failed save gets
+// the same deltas. The owner serializes the calls.
+type cumulative struct {
+	series  map[string]cumulativeSeries
+	pending map[string]cumulativeSeries
+}
+
+func newCumulative() *cumulative {
+	return &cumulative{
+		series:  make(map[string]cumulativeSeries),
+		pending: make(map[string]cumulativeSeries),
+	}
+}
+
+func (c *cumulative) get(key string) (cumulativeSeries, bool) {
+	if s, ok := c.pending[key]; ok {
+		return s, true
+	}
+	s, ok := c.series[key]
+	return s, ok
+}
+
+// delta returns the increase of the series since its last value, the whole
+// value after a reset or for a new series. The last value of the source
+// isn't known for a series that wasn't seen before but is stored already,
+// e.g. after a restart or when another source updates it, so its first value
+// is only the baseline of the next ones.
+func (c *cumulative) delta(key string, v float64, stored func() bool) float64 {
+	s, ok := c.get(key)
+	last := s.last
+	s.last = v
+	c.pending[key] = s
+	switch {
+	case !ok && stored():
+		return 0
+	case !ok || v < last:
+		return v
+	}
+	return v - last
+}
+
+// whole returns the integer part of the increase of the series and carries
+// the fraction over to its next increase, counters store integers.
+func (c *cumulative) whole(key string, delta float64) int64 {
+	s, _ := c.get(key)
+	delta += s.rem
+	res := math.Floor(delta)
+	s.rem = delta - res
+	c.pending[key] = s
+	return int64(res)
+}
+
+// commit keeps the pending changes after the metrics are stored.
+func (c *cumulative) commit() {
+	for key, s := range c.pending {
+		c.series[key] = s
+	}
+	clear(c.pending)
+}
+
+// rollback drops the pending changes after the metrics weren't stored.
+func (c *cumulative) rollback() {
+	clear(c.pending)
+}
+
+// histogramDelta returns the observations since the last cumulative
+// histogram of the series, the whole histogram after a reset or when the
+// buckets change.
+func histogramDelta(last, h *metrics.Histogram) *metrics.Histogram {
+	if last == nil || h.Count < last.Count || len(last.Bounds) != len(h.Bounds) || len(last.Counts) != len(h.Counts) {
+		return h.Clone()
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != last.Bounds[i] {
+			return h.Clone()
+		}
+	}
+	res := h.Clone()
+	for i := range res.Counts {
+		if res.Counts[i] < last.Counts[i] {
+			return h.Clone()
+		}
+		res.Counts[i] -= last.Counts[i]
+	}
+	res.Sum -= last.Sum
+	res.Count -= last.Count
+	return res
+}
@@ -0,0 +1,154 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// ParseLineProtocol parses InfluxDB line protocol, a gauge per numeric or
+// boolean field named measurement_field with the tags as labels. String
+// fields are skipped and the timestamps are ignored, the metrics are stored
+// at the time they are received. Lines that can't be parsed are skipped and
+// reported in the error, so the caller can store the rest like InfluxDB
+// does with partial writes.
+func ParseLineProtocol(b []byte) ([]metrics.Metric, error) {
+	var res []metrics.Metric
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ms, err := parseInfluxLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", n, err))
+			continue
+		}
+		res = append(res, ms...)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return res, fmt.Errorf("%w: %w", ErrInvalidRequest, errors.Join(errs...))
+	}
+	return res, nil
+}
+
+func parseInfluxLine(line string) ([]metrics.Metric, error) {
+	key, rest := split(line, ' ', false)
+	fieldSet, _ := split(rest, ' ', true)
+	if fieldSet == "" {
+		return nil, errors.New("no fields")
+	}
+
+	parts := splitAll(key, ',', false)
+	measurement := unescapeInflux(parts[0])
+	if measurement == "" {
+		return nil, errors.New("no measurement")
+	}
+	var labels map[string]string
+	for _, tag := range parts[1:] {
+		k, v := split(tag, '=', false)
+		if k == "" || v == "" {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[unescapeInflux(k)] = unescapeInflux(v)
+	}
+
+	var res []metrics.Metric
+	for _, field := range splitAll(fieldSet, ',', true) {
+		k, v := split(field, '=', false)
+		if k == "" || v == "" {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		value, ok, err := fieldValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", unescapeInflux(k), err)
+		}
+		if !ok {
+			continue
+		}
+		res = append(res, metrics.Metric{
+			ID:     measurement + "_" + unescapeInflux(k),
+			MType:  metrics.TypeGauge,
+			Value:  &value,
+			Labels: labels,
+		})
+	}
+	return res, nil
+}
+
+// fieldValue parses a float, integer (i suffix), unsigned (u suffix) or
+// boolean field. ok is false for strings.
+func fieldValue(v string) (value float64, ok bool, err error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) {
+			return 0, false, errors.New("unterminated string")
+		}
+		return 0, false, nil
+	case v == "t" || v == "T" || v == "true" || v == "True" || v == "TRUE":
+		return 1, true, nil
+	case v == "f" || v == "F" || v == "false" || v == "False" || v == "FALSE":
+		return 0, true, nil
+	case strings.HasSuffix(v, "i"):
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(i), err == nil, err
+	case strings.HasSuffix(v, "u"):
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(u), err == nil, err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err == nil && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		err = fmt.Errorf("value %s isn't finite", v)
+	}
+	return f, err == nil, err
+}
+
+// split splits s at the first sep that isn't escaped with a backslash, nor
+// in a string value if quotes is set.
+func split(s string, sep byte, quotes bool) (string, string) {
+	var quoted bool
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quotes:
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+func splitAll(s string, sep byte, quotes bool) []string {
+	var res []string
+	for {
+		part, rest := split(s, sep, quotes)
+		res = append(res, part)
+		if len(part) == len(s) {
+			return res
+		}
+		s = rest
+	}
+}
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`)
+
+func unescapeInflux(s string) string {
+	return influxUnescaper.Replace(s)
+}
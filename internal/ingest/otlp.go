@@ -0,0 +1,292 @@
+package ingest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+// resourceLabels are the resource attributes identifying the source of the
+// metrics, they become labels named like the ones of the agent. The other
+// resource attributes, e.g. the SDK version, would only split the series.
+var resourceLabels = map[string]string{
+	"service.name":           "service",
+	"service.namespace":      "namespace",
+	"service.instance.id":    "instance",
+	"host.name":              "host",
+	"deployment.environment": "env",
+}
+
+// DecodeOTLP decodes an ExportMetricsServiceRequest in the protobuf or the
+// JSON encoding of OTLP/HTTP.
+func DecodeOTLP(b []byte, contentType string) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	var req colmetricspb.ExportMetricsServiceRequest
+	var err error
+	switch contentType {
+	case ContentTypeProtobuf:
+		err = proto.Unmarshal(b, &req)
+	case ContentTypeJSON:
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, &req)
+	default:
+		return nil, fmt.Errorf("%w: unsupported content type %q", ErrInvalidRequest, contentType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	return &req, nil
+}
+
+// EncodeOTLP encodes a response like the request it answers.
+func EncodeOTLP(res *colmetricspb.ExportMetricsServiceResponse, contentType string) ([]byte, error) {
+	if contentType == ContentTypeJSON {
+		return protojson.Marshal(res)
+	}
+	return proto.Marshal(res)
+}
+
+// OTLPResult holds the converted metrics and the data points that aren't
+// supported, which OTLP reports as a partial success.
+type OTLPResult struct {
+	Metrics  []metrics.Metric
+	Rejected int64
+	Reason   string
+}
+
+// OTLP converts OpenTelemetry metrics. Sums become counters and histograms
+// histograms, the cumulative ones are turned into deltas. Non-monotonic
+// cumulative sums go up and down, they become gauges like Gauge.
+type OTLP struct {
+	mu         sync.Mutex
+	counters   *cumulative
+	histograms map[string]*metrics.Histogram
+	// pending are the last cumulative histograms until the save succeeds
+	pending map[string]*metrics.Histogram
+}
+
+func NewOTLP() *OTLP {
+	return &OTLP{
+		counters:   newCumulative(),
+		histograms: make(map[string]*metrics.Histogram),
+		pending:    make(map[string]*metrics.Histogram),
+	}
+}
+
+// Store converts the request and saves the metrics. The state of the
+// cumulative series is kept only when save succeeds, so an export retried
+// after a failure gets the same deltas.
+func (o *OTLP) Store(req *colmetricspb.ExportMetricsServiceRequest, stored Lookup, save Save) (*OTLPResult, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	res := o.convert(req, stored)
+	if len(res.Metrics) > 0 {
+		if err := save(res.Metrics); err != nil {
+			o.counters.rollback()
+			clear(o.pending)
+			return nil, err
+		}
+	}
+	o.counters.commit()
+	for key, h := range o.pending {
+		o.histograms[key] = h
+	}
+	clear(o.pending)
+	return res, nil
+}
+
+// convert expects the caller to hold the lock.
+func (o *OTLP) convert(req *colmetricspb.ExportMetricsServiceRequest, stored Lookup) *OTLPResult {
+	var res OTLPResult
+	reject := func(n int, reason string) {
+		res.Rejected += int64(n)
+		if res.Reason == "" {
+			res.Reason = reason
+		}
+	}
+
+	for _, rm := range req.GetResourceMetrics() {
+		resource := make(map[string]string)
+		for _, kv := range rm.GetResource().GetAttributes() {
+			if name, ok := resourceLabels[kv.GetKey()]; ok {
+				resource[name] = attributeValue(kv.GetValue())
+			}
+		}
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				name := m.GetName()
+				if name == "" {
+					reject(dataPoints(m), "metric without name")
+					continue
+				}
+				switch {
+				case m.GetSum() != nil:
+					res.Metrics = append(res.Metrics, o.convertSum(name, m.GetSum(), resource, stored)...)
+				case m.GetGauge() != nil:
+					for _, dp := range m.GetGauge().GetDataPoints() {
+						if v, ok := numberValue(dp); ok {
+							res.Metrics = append(res.Metrics, metrics.Metric{ID: name, MType: metrics.TypeGauge, Value: &v, Labels: labels(resource, dp.GetAttributes())})
+						}
+					}
+				case m.GetHistogram() != nil:
+					res.Metrics = append(res.Metrics, o.convertHistogram(name, m.GetHistogram(), resource, stored)...)
+				case m.GetExponentialHistogram() != nil:
+					reject(dataPoints(m), fmt.Sprintf("exponential histogram %s isn't supported, use explicit buckets", name))
+				case m.GetSummary() != nil:
+					reject(dataPoints(m), fmt.Sprintf("summary %s isn't supported, send raw observations to /update/", name))
+				}
+			}
+		}
+	}
+	return &res
+}
+
+func (o *OTLP) convertSum(name string, sum *metricspb.Sum, resource map[string]string, stored Lookup) []metrics.Metric {
+	cumulative := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	var res []metrics.Metric
+	for _, dp := range sum.GetDataPoints() {
+		v, ok := numberValue(dp)
+		if !ok {
+			continue
+		}
+		lbls := labels(resource, dp.GetAttributes())
+		if cumulative && !sum.GetIsMonotonic() {
+			res = append(res, metrics.Metric{ID: name, MType: metrics.TypeGauge, Value: &v, Labels: lbls})
+			continue
+		}
+		key := metrics.SeriesKey(name, lbls)
+		if cumulative {
+			v = o.counters.delta(key, v, func() bool {
+				return stored(metrics.TypeCounter, name, lbls) != nil
+			})
+		}
+		delta := o.counters.whole(key, v)
+		res = append(res, metrics.Metric{ID: name, MType: metrics.TypeCounter, Delta: &delta, Labels: lbls})
+	}
+	return res
+}
+
+func (o *OTLP) convertHistogram(name string, histogram *metricspb.Histogram, resource map[string]string, stored Lookup) []metrics.Metric {
+	cumulative := histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	var res []metrics.Metric
+	for _, dp := range histogram.GetDataPoints() {
+		if dp.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+			continue
+		}
+		h := &metrics.Histogram{
+			Bounds: dp.GetExplicitBounds(),
+			Counts: dp.GetBucketCounts(),
+			Sum:    dp.GetSum(),
+			Count:  dp.GetCount(),
+		}
+		if len(h.Counts) == 0 {
+			// the point has the count and sum only
+			h.Bounds = nil
+			h.Counts = []uint64{h.Count}
+		}
+		lbls := labels(resource, dp.GetAttributes())
+		if cumulative {
+			key := metrics.SeriesKey(name, lbls)
+			last, ok := o.pending[key]
+			if !ok {
+				last, ok = o.histograms[key]
+			}
+			o.pending[key] = h.Clone()
+			if !ok && stored(metrics.TypeHistogram, name, lbls) != nil {
+				// the first point of a stored series is only the baseline
+				// like for the sums
+				continue
+			}
+			h = histogramDelta(last, h)
+		}
+		res = append(res, metrics.Metric{ID: name, MType: metrics.TypeHistogram, Histogram: h, Labels: lbls})
+	}
+	return res
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	if dp.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+		return 0, false
+	}
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), true
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble, !math.IsNaN(v.AsDouble)
+	}
+	return 0, false
+}
+
+func dataPoints(m *metricspb.Metric) int {
+	switch {
+	case m.GetSum() != nil:
+		return len(m.GetSum().GetDataPoints())
+	case m.GetGauge() != nil:
+		return len(m.GetGauge().GetDataPoints())
+	case m.GetHistogram() != nil:
+		return len(m.GetHistogram().GetDataPoints())
+	case m.GetExponentialHistogram() != nil:
+		return len(m.GetExponentialHistogram().GetDataPoints())
+	case m.GetSummary() != nil:
+		return len(m.GetSummary().GetDataPoints())
+	}
+	return 0
+}
+
+// labels merges the identifying resource attributes with the data point
+// attributes, which win on conflicts.
+func labels(resource map[string]string, attributes []*commonpb.KeyValue) map[string]string {
+	if len(resource) == 0 && len(attributes) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(resource)+len(attributes))
+	for k, v := range resource {
+		res[k] = v
+	}
+	for _, kv := range attributes {
+		res[kv.GetKey()] = attributeValue(kv.GetValue())
+	}
+	return res
+}
+
+func attributeValue(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]string, 0, len(v.ArrayValue.GetValues()))
+		for _, value := range v.ArrayValue.GetValues() {
+			values = append(values, attributeValue(value))
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	case *commonpb.AnyValue_KvlistValue:
+		values := make([]string, 0, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			values = append(values, kv.GetKey()+"="+attributeValue(kv.GetValue()))
+		}
+		return "{" + strings.Join(values, ",") + "}"
+	}
+	return ""
+}
@@ -0,0 +1,310 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	ErrInvalidRequest     = errors.New("invalid request")
+	ErrUnsupportedSamples = errors.New("unsupported sample type")
+)
+
+// Metric types of the remote_write metadata, the others are kept as gauges.
+const (
+	promCounter   int32 = 1
+	promHistogram int32 = 3
+	promSummary   int32 = 5
+)
+
+// WriteRequest is the part of the Prometheus remote_write (1.0) message the
+// server uses, exemplars are skipped.
+type WriteRequest struct {
+	Series   []TimeSeries
+	Metadata []MetricMetadata
+}
+
+type TimeSeries struct {
+	Labels  map[string]string
+	Samples []Sample
+	// Histograms is the number of native histogram samples, they aren't decoded.
+	Histograms int
+}
+
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+type MetricMetadata struct {
+	Type   int32
+	Family string
+}
+
+// DecodeWriteRequest decodes a snappy compressed protobuf WriteRequest.
+func DecodeWriteRequest(b []byte) (*WriteRequest, error) {
+	b, err := snappy.Decode(nil, b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: snappy: %w", ErrInvalidRequest, err)
+	}
+
+	var req WriteRequest
+	err = decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			ts, err := decodeTimeSeries(v)
+			if err != nil {
+				return err
+			}
+			req.Series = append(req.Series, *ts)
+		case 3:
+			md, err := decodeMetadata(v)
+			if err != nil {
+				return err
+			}
+			req.Metadata = append(req.Metadata, *md)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func decodeTimeSeries(b []byte) (*TimeSeries, error) {
+	ts := TimeSeries{Labels: make(map[string]string)}
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			var name, value string
+			err := decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels[name] = value
+		case 2:
+			var s Sample
+			err := decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch num {
+				case 1:
+					if typ != protowire.Fixed64Type {
+						return fmt.Errorf("%w: sample value isn't a double", ErrInvalidRequest)
+					}
+					bits, _ := protowire.ConsumeFixed64(v)
+					s.Value = math.Float64frombits(bits)
+				case 2:
+					ts, _ := protowire.ConsumeVarint(v)
+					s.Timestamp = int64(ts)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		case 4:
+			ts.Histograms++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+func decodeMetadata(b []byte) (*MetricMetadata, error) {
+	var md MetricMetadata
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			t, _ := protowire.ConsumeVarint(v)
+			md.Type = int32(t)
+		case 2:
+			md.Family = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// decodeMessage calls fn with every field of the message. Length delimited
+// values are passed without their length, the others in their wire encoding.
+func decodeMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var v []byte
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %w", ErrInvalidRequest, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoteWrite converts remote_write series to metrics. Prometheus sends the
+// cumulative values of counters, they are turned into deltas. The metric
+// types are learned from the metadata, which Prometheus sends in separate
+// requests.
+type RemoteWrite struct {
+	mu       sync.Mutex
+	types    map[string]int32
+	counters *cumulative
+}
+
+func NewRemoteWrite() *RemoteWrite {
+	return &RemoteWrite{
+		types:    make(map[string]int32),
+		counters: newCumulative(),
+	}
+}
+
+// Store saves a metric per series with the latest gauge value or the counter
+// increase over all its samples. The request is rejected as a whole if it
+// has native histograms. The last values of the counters are kept only when
+// save succeeds, so Prometheus retrying the request doesn't lose increases.
+func (rw *RemoteWrite) Store(req *WriteRequest, stored Lookup, save Save) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	ms, err := rw.convert(req, stored)
+	if err == nil && len(ms) > 0 {
+		err = save(ms)
+	}
+	if err != nil {
+		rw.counters.rollback()
+		return err
+	}
+	rw.counters.commit()
+	return nil
+}
+
+// convert expects the caller to hold the lock.
+func (rw *RemoteWrite) convert(req *WriteRequest, stored Lookup) ([]metrics.Metric, error) {
+	for _, ts := range req.Series {
+		if ts.Histograms > 0 {
+			return nil, fmt.Errorf("%w: native histograms of %s, use classic histograms", ErrUnsupportedSamples, ts.Labels["__name__"])
+		}
+		if ts.Labels["__name__"] == "" {
+			return nil, fmt.Errorf("%w: series without __name__ label", ErrInvalidRequest)
+		}
+	}
+
+	for _, md := range req.Metadata {
+		rw.types[md.Family] = md.Type
+	}
+
+	var res []metrics.Metric
+	for _, ts := range req.Series {
+		name := ts.Labels["__name__"]
+		labels := make(map[string]string, len(ts.Labels)-1)
+		for k, v := range ts.Labels {
+			if k != "__name__" {
+				labels[k] = v
+			}
+		}
+		if len(labels) == 0 {
+			labels = nil
+		}
+
+		switch rw.metricType(name) {
+		case metrics.TypeCounter:
+			key := metrics.SeriesKey(name, labels)
+			var delta float64
+			var updated bool
+			for _, s := range ts.Samples {
+				if math.IsNaN(s.Value) {
+					// stale marker
+					continue
+				}
+				delta += rw.counters.delta(key, s.Value, func() bool {
+					return stored(metrics.TypeCounter, name, labels) != nil
+				})
+				updated = true
+			}
+			if !updated {
+				continue
+			}
+			d := rw.counters.whole(key, delta)
+			res = append(res, metrics.Metric{ID: name, MType: metrics.TypeCounter, Delta: &d, Labels: labels})
+		default:
+			var value *float64
+			for _, s := range ts.Samples {
+				if !math.IsNaN(s.Value) {
+					v := s.Value
+					value = &v
+				}
+			}
+			if value == nil {
+				continue
+			}
+			res = append(res, metrics.Metric{ID: name, MType: metrics.TypeGauge, Value: value, Labels: labels})
+		}
+	}
+	return res, nil
+}
+
+// metricType maps the series onto a counter or a gauge. The buckets and
+// counts of histograms and summaries are counters, their sums may be
+// fractional so they are gauges like everything else. Without metadata the
+// _total suffix marks counters. It expects the caller to hold the lock.
+func (rw *RemoteWrite) metricType(name string) string {
+	if t, ok := rw.types[name]; ok {
+		if t == promCounter {
+			return metrics.TypeCounter
+		}
+		return metrics.TypeGauge
+	}
+	for _, suffix := range []string{"_total", "_bucket", "_count", "_sum"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		t, known := rw.types[family]
+		switch {
+		case suffix == "_total" && (!known || t == promCounter):
+			return metrics.TypeCounter
+		case suffix == "_bucket" && t == promHistogram:
+			return metrics.TypeCounter
+		case suffix == "_count" && (t == promHistogram || t == promSummary):
+			return metrics.TypeCounter
+		}
+	}
+	return metrics.TypeGauge
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	ConditionGreater      = ">"
+	ConditionGreaterEqual = ">="
+	ConditionLess         = "<"
+	ConditionLessEqual    = "<="
+	ConditionEqual        = "=="
+	ConditionNotEqual     = "!="
+	// ConditionStale matches when the metric value hasn't changed since the previous evaluation.
+	ConditionStale = "stale"
+)
+
+const (
+	AlertInactive = "inactive"
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Kinds of alert history events, besides the alert states.
+const (
+	EventAcknowledged = "acknowledged"
+	EventSilenced     = "silenced"
+	EventNotified     = "notified"
+	EventNotifyFailed = "notification_failed"
+)
+
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+type AlertRule struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	MType string `json:"type"`
+	MName string `json:"metric"`
+	// Labels select the series of the metric, none selects the series without labels.
+	Labels    map[string]string `json:"labels,omitempty"`
+	Condition string            `json:"condition"`
+	Threshold float64           `json:"threshold"`
+	// For is how long (in seconds) the condition has to hold before the alert fires.
+	For int `json:"for,omitempty"`
+	// Hysteresis is how far the value has to move back past the threshold to resolve a firing alert.
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+	Disabled   bool    `json:"disabled"`
+}
+
+type Alert struct {
+	RuleID     string     `json:"rule_id"`
+	State      string     `json:"state"`
+	Value      float64    `json:"value"`
+	ActiveAt   *time.Time `json:"active_at,omitempty"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	// AcknowledgedBy is who stopped the re-notifications of the firing alert.
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty"`
+}
+
+// AlertEvent is an entry of the append-only alert history.
+type AlertEvent struct {
+	ID       int64     `json:"id"`
+	RuleID   string    `json:"rule_id"`
+	Kind     string    `json:"kind"`
+	State    string    `json:"state"`
+	Value    float64   `json:"value"`
+	Actor    string    `json:"actor,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Notifier string    `json:"notifier,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notification is sent to the notifiers when an alert fires or resolves.
+type Notification struct {
+	RuleID    string    `json:"rule_id"`
+	RuleName  string    `json:"rule_name,omitempty"`
+	MType     string    `json:"type"`
+	MName     string    `json:"metric"`
+	Condition string    `json:"condition"`
+	Threshold float64   `json:"threshold"`
+	State     string    `json:"state"`
+	Value     float64   `json:"value"`
+	Time      time.Time `json:"time"`
+	// Labels identify the series the alert is about, e.g. the host of the agent.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Silence mutes notifications of the alerts matching all its non-empty
+// matchers between StartsAt and EndsAt.
+type Silence struct {
+	ID        string    `json:"id"`
+	Metric    string    `json:"metric,omitempty"`
+	MType     string    `json:"type,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is a notification queued for a single notifier.
+type Delivery struct {
+	ID           string       `json:"id"`
+	Notifier     string       `json:"notifier"`
+	Notification Notification `json:"notification"`
+	Status       string       `json:"status"`
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"last_error,omitempty"`
+	NextAttempt  time.Time    `json:"next_attempt"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// NewID returns a random identifier for rules, deliveries and other
+// objects created by the server.
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var ErrInvalidHistogram = errors.New("invalid histogram")
+
+// DefaultBuckets are the bucket upper bounds of histograms created from a
+// single observation, e.g. request latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultQuantiles are the quantiles estimated for the responses of /value/.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Histogram counts observations in buckets. Updates carry the observations
+// since the last report and are added to the stored histogram like counter deltas.
+type Histogram struct {
+	// Bounds are the ascending upper bounds of the buckets, the last bucket
+	// without a bound counts the observations above all of them.
+	Bounds []float64 `json:"bounds"`
+	// Counts holds the observations of every bucket, len(Bounds)+1 values.
+	Counts []uint64 `json:"counts"`
+	Sum    float64  `json:"sum"`
+	Count  uint64   `json:"count"`
+	// Quantiles are the estimates returned by /value/, they aren't stored.
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+}
+
+// NewHistogram returns an empty histogram with the bucket bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds a single observation.
+func (h *Histogram) Observe(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%w: observation %v isn't finite", ErrInvalidHistogram, v)
+	}
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+	return nil
+}
+
+// Validate checks the buckets and the sum and fills Count when it isn't set.
+func (h *Histogram) Validate() error {
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("%w: sum %v isn't finite", ErrInvalidHistogram, h.Sum)
+	}
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: %d bounds need %d counts, got %d", ErrInvalidHistogram, len(h.Bounds), len(h.Bounds)+1, len(h.Counts))
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) || (i > 0 && b <= h.Bounds[i-1]) {
+			return fmt.Errorf("%w: bounds must be finite and ascending", ErrInvalidHistogram)
+		}
+	}
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if h.Count == 0 {
+		h.Count = total
+	}
+	if h.Count != total {
+		return fmt.Errorf("%w: count %d doesn't match the bucket counts %d", ErrInvalidHistogram, h.Count, total)
+	}
+	return nil
+}
+
+// Merge adds the observations of o, the histograms need the same bounds.
+func (h *Histogram) Merge(o *Histogram) error {
+	if len(h.Bounds) != len(o.Bounds) {
+		return fmt.Errorf("%w: bucket bounds don't match the stored histogram", ErrInvalidHistogram)
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != o.Bounds[i] {
+			return fmt.Errorf("%w: bucket bounds don't match the stored histogram", ErrInvalidHistogram)
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// Clone returns a deep copy without the quantiles.
+func (h *Histogram) Clone() *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Quantile estimates the q-quantile by linear interpolation inside the
+// bucket it falls in. Observations above the last bound are reported as the
+// last bound, the first bucket starts at 0 unless its bound is negative.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	if len(h.Bounds) == 0 {
+		return math.NaN()
+	}
+	rank := q * float64(h.Count)
+	var seen float64
+	for i, c := range h.Counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		if i == len(h.Bounds) {
+			return h.Bounds[len(h.Bounds)-1]
+		}
+		upper := h.Bounds[i]
+		lower := math.Min(0, upper)
+		if i > 0 {
+			lower = h.Bounds[i-1]
+		}
+		return lower + (upper-lower)*(rank-seen)/float64(c)
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+// WithQuantiles returns a copy with the estimates of the quantiles filled in.
+func (h *Histogram) WithQuantiles(qs []float64) *Histogram {
+	res := h.Clone()
+	res.Quantiles = make(map[string]float64, len(qs))
+	for _, q := range qs {
+		if v := h.Quantile(q); !math.IsNaN(v) {
+			res.Quantiles[strconv.FormatFloat(q, 'f', -1, 64)] = v
+		}
+	}
+	return res
+}
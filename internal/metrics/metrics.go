@@ -1,10 +1,20 @@
 package metrics
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type MetricType string
 
 const (
-	TypeCounter = "counter"
-	TypeGauge   = "gauge"
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeSet       = "set"
 )
 
 type AgentMetric struct {
@@ -12,6 +22,8 @@ type AgentMetric struct {
 	ID    string `json:"id"`
 	Value any    `json:"value,omitempty"`
 	Delta any    `json:"delta,omitempty"`
+	// Labels are the dimensions of the series, e.g. the host of the agent.
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type Metric struct {
@@ -19,12 +31,170 @@ type Metric struct {
 	MType string   `json:"type"`
 	Delta *int64   `json:"delta,omitempty"`
 	Value *float64 `json:"value,omitempty"`
+	// Histogram is set for the histogram type only.
+	Histogram *Histogram `json:"histogram,omitempty"`
+	// Summary is the quantile sketch of the summary type, updates may carry
+	// a sketch to merge, raw Observations or both.
+	Summary      *Summary  `json:"summary,omitempty"`
+	Observations []float64 `json:"observations,omitempty"`
+	// Set is the distinct count sketch of the set type, updates may carry a
+	// sketch to merge, string Members or both.
+	Set     *Set     `json:"set,omitempty"`
+	Members []string `json:"members,omitempty"`
+	// Labels are part of the series identity, metrics with the same ID and
+	// different labels are stored separately.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Key identifies the series of the metric within its type.
+func (m Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// Clone returns a deep copy, the sketches are copied without their estimates.
+func (m Metric) Clone() Metric {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
+	}
+	if m.Histogram != nil {
+		m.Histogram = m.Histogram.Clone()
+	}
+	if m.Summary != nil {
+		m.Summary = m.Summary.Clone()
+	}
+	if m.Set != nil {
+		m.Set = m.Set.Clone()
+	}
+	m.Observations = append([]float64(nil), m.Observations...)
+	m.Members = append([]string(nil), m.Members...)
+	if m.Labels != nil {
+		labels := make(map[string]string, len(m.Labels))
+		for name, value := range m.Labels {
+			labels[name] = value
+		}
+		m.Labels = labels
+	}
+	return m
+}
+
+// SeriesKey returns id followed by the labels sorted by name, e.g.
+// HeapAlloc{host="a",service="b"}. Without labels the key is the id.
+func SeriesKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(id)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Sample is the value of a series at a point in time, the running total for counters.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggLast = "last"
+	AggSum  = "sum"
+)
+
+type RangeQuery struct {
+	ID     string
+	MType  string
+	Labels map[string]string
+	From   time.Time
+	To     time.Time
+	// Step is the width of the aggregation buckets, zero returns the raw samples.
+	Step time.Duration
+	Agg  string
+}
+
+// Rollup summarizes the samples of a series in the bucket starting at Time.
+type Rollup struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Sum   float64   `json:"sum"`
+	Count int64     `json:"count"`
+	Last  float64   `json:"last"`
+}
+
+// Point is an aggregated value of a series, Value is nil when the step has no samples.
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value *float64  `json:"value"`
+}
+
+type History struct {
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Agg    string            `json:"agg,omitempty"`
+	Step   string            `json:"step"`
+	// Resolution is the bucket width of the data the points are computed from, 0s for raw samples.
+	Resolution string  `json:"resolution"`
+	Points     []Point `json:"points"`
+}
+
+// ValueOf returns the metric value as a float, false if it isn't set.
+// Histograms and summaries are represented by the number of observations,
+// sets by the estimated number of distinct members.
+func ValueOf(m Metric) (float64, bool) {
+	switch m.MType {
+	case TypeGauge:
+		if m.Value != nil {
+			return *m.Value, true
+		}
+	case TypeCounter:
+		if m.Delta != nil {
+			return float64(*m.Delta), true
+		}
+	case TypeHistogram:
+		if m.Histogram != nil {
+			return float64(m.Histogram.Count), true
+		}
+	case TypeSummary:
+		if m.Summary != nil {
+			return float64(m.Summary.Count), true
+		}
+	case TypeSet:
+		if m.Set != nil {
+			return float64(m.Set.Estimate()), true
+		}
+	}
+	return 0, false
 }
 
 type Error struct {
 	Error string `json:"error"`
 }
 
+// Data holds the metrics by type and series key, see SeriesKey.
 type Data map[string]map[string]Metric
 
 var GaugeMetrics = []string{
@@ -34,8 +204,47 @@ var GaugeMetrics = []string{
 	"HeapInuse", "HeapObjects", "HeapReleased", "HeapSys", "LastGC", "Lookups", "MCacheInuse",
 }
 
+// GopsutilGaugeMetrics are reported along with CPUutilization1..N, the
+// utilization of every CPU core. The CPU metrics are in percent.
 var GopsutilGaugeMetrics = []string{
 	"TotalMemory",
 	"FreeMemory",
-	"CPUutilization1",
+	"CPUutilization",
+	"CPUiowait",
+	"CPUsteal",
+	"LoadAverage1",
+	"LoadAverage5",
+	"LoadAverage15",
+}
+
+// DiskGaugeMetrics are reported per mountpoint.
+var DiskGaugeMetrics = []string{
+	"DiskTotal",
+	"DiskFree",
+	"DiskUsedPercent",
+	"DiskInodesTotal",
+	"DiskInodesFree",
+	"DiskInodesUsedPercent",
+}
+
+// DiskCounterMetrics are reported per device along with their per second
+// rates, the gauges named <counter>Rate.
+var DiskCounterMetrics = []string{
+	"DiskReadBytes",
+	"DiskWriteBytes",
+	"DiskReads",
+	"DiskWrites",
+}
+
+// NetCounterMetrics are reported per network interface along with their per
+// second rates, the gauges named <counter>Rate.
+var NetCounterMetrics = []string{
+	"NetBytesSent",
+	"NetBytesRecv",
+	"NetPacketsSent",
+	"NetPacketsRecv",
+	"NetErrorsIn",
+	"NetErrorsOut",
+	"NetDropsIn",
+	"NetDropsOut",
 }
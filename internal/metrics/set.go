@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+var ErrInvalidSet = errors.New("invalid set")
+
+// SetPrecision is the number of hash bits selecting a register, 2^14
+// registers estimate the cardinality with a standard error of about 0.8%.
+const SetPrecision = 14
+
+// Set estimates the number of distinct members with a HyperLogLog sketch,
+// the members themselves aren't kept. Sketches are merged by taking the
+// maximum of every register.
+type Set struct {
+	Precision uint8  `json:"precision"`
+	Registers []byte `json:"registers,omitempty"`
+	// Cardinality is the estimate returned by /value/, it isn't stored.
+	Cardinality uint64 `json:"cardinality,omitempty"`
+}
+
+// NewSet returns an empty sketch with the default precision.
+func NewSet() *Set {
+	return &Set{
+		Precision: SetPrecision,
+		Registers: make([]byte, 1<<SetPrecision),
+	}
+}
+
+// Add records a member.
+func (s *Set) Add(member string) {
+	x := hashMember(member)
+	i := x >> (64 - s.Precision)
+	// the guard bit bounds the rank when the remaining bits are all zero
+	w := x<<s.Precision | 1<<(s.Precision-1)
+	rank := byte(bits.LeadingZeros64(w) + 1)
+	if rank > s.Registers[i] {
+		s.Registers[i] = rank
+	}
+}
+
+// Validate checks that the sketch can be merged with the stored ones.
+func (s *Set) Validate() error {
+	if s.Precision != SetPrecision {
+		return fmt.Errorf("%w: precision must be %d", ErrInvalidSet, SetPrecision)
+	}
+	if len(s.Registers) != 1<<SetPrecision {
+		return fmt.Errorf("%w: %d registers expected, got %d", ErrInvalidSet, 1<<SetPrecision, len(s.Registers))
+	}
+	return nil
+}
+
+// Merge adds the members of o.
+func (s *Set) Merge(o *Set) error {
+	if s.Precision != o.Precision || len(s.Registers) != len(o.Registers) {
+		return fmt.Errorf("%w: precision doesn't match the stored set", ErrInvalidSet)
+	}
+	for i, r := range o.Registers {
+		if r > s.Registers[i] {
+			s.Registers[i] = r
+		}
+	}
+	return nil
+}
+
+// Clone returns a deep copy without the cardinality.
+func (s *Set) Clone() *Set {
+	return &Set{
+		Precision: s.Precision,
+		Registers: append([]byte(nil), s.Registers...),
+	}
+}
+
+// Estimate returns the estimated number of distinct members. Small sets are
+// counted from the empty registers, which is more accurate for them.
+func (s *Set) Estimate() uint64 {
+	m := float64(len(s.Registers))
+	if m == 0 {
+		return 0
+	}
+	var sum float64
+	var zeros int
+	for _, r := range s.Registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// WithCardinality returns the estimate without the registers for responses.
+func (s *Set) WithCardinality() *Set {
+	return &Set{
+		Precision:   s.Precision,
+		Cardinality: s.Estimate(),
+	}
+}
+
+// hashMember is FNV-1a finished with the MurmurHash3 mixer, which spreads
+// similar members over all the bits the registers and ranks are taken from.
+func hashMember(member string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+var ErrInvalidSummary = errors.New("invalid summary")
+
+// SummaryAccuracy is the relative error of the quantiles estimated by summaries.
+const SummaryAccuracy = 0.01
+
+// minSummaryValue is the smallest magnitude with its own bucket, smaller
+// observations are counted as zero.
+const minSummaryValue = 1e-9
+
+// Summary is a streaming quantile sketch (DDSketch). Observations are counted
+// in logarithmic buckets, so every estimate is within Alpha of the real
+// quantile relative to its value, and sketches are merged by adding the
+// bucket counts. The number of buckets grows with the log of the value
+// range only, about 2000 per sign for values from 1e-9 to 1e9.
+type Summary struct {
+	Alpha    float64        `json:"alpha"`
+	Positive map[int]uint64 `json:"positive,omitempty"`
+	Negative map[int]uint64 `json:"negative,omitempty"`
+	Zero     uint64         `json:"zero,omitempty"`
+	Count    uint64         `json:"count"`
+	Sum      float64        `json:"sum"`
+	Min      float64        `json:"min"`
+	Max      float64        `json:"max"`
+	// Quantiles are the estimates returned by /value/, they aren't stored.
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+}
+
+// NewSummary returns an empty sketch with the default accuracy.
+func NewSummary() *Summary {
+	return &Summary{
+		Alpha:    SummaryAccuracy,
+		Positive: make(map[int]uint64),
+		Negative: make(map[int]uint64),
+	}
+}
+
+func (s *Summary) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// Observe adds a single observation.
+func (s *Summary) Observe(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%w: observation %v isn't finite", ErrInvalidSummary, v)
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	switch {
+	case v > minSummaryValue:
+		s.Positive[s.index(v)]++
+	case v < -minSummaryValue:
+		s.Negative[s.index(-v)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	return nil
+}
+
+func (s *Summary) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value is the estimate of the observations in the bucket, it is within
+// Alpha of all of them.
+func (s *Summary) value(i int) float64 {
+	return 2 * math.Pow(s.gamma(), float64(i)) / (s.gamma() + 1)
+}
+
+// Validate checks that the sketch can be merged with the stored ones.
+func (s *Summary) Validate() error {
+	if s.Alpha != SummaryAccuracy {
+		return fmt.Errorf("%w: accuracy must be %v", ErrInvalidSummary, SummaryAccuracy)
+	}
+	total := s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count {
+		return fmt.Errorf("%w: count %d doesn't match the bucket counts %d", ErrInvalidSummary, s.Count, total)
+	}
+	return nil
+}
+
+// Merge adds the observations of o.
+func (s *Summary) Merge(o *Summary) error {
+	if s.Alpha != o.Alpha {
+		return fmt.Errorf("%w: accuracy doesn't match the stored summary", ErrInvalidSummary)
+	}
+	if o.Count == 0 {
+		return nil
+	}
+	if s.Positive == nil {
+		s.Positive = make(map[int]uint64)
+	}
+	if s.Negative == nil {
+		s.Negative = make(map[int]uint64)
+	}
+	for i, c := range o.Positive {
+		s.Positive[i] += c
+	}
+	for i, c := range o.Negative {
+		s.Negative[i] += c
+	}
+	s.Zero += o.Zero
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	return nil
+}
+
+// Clone returns a deep copy without the quantiles.
+func (s *Summary) Clone() *Summary {
+	res := *s
+	res.Quantiles = nil
+	res.Positive = make(map[int]uint64, len(s.Positive))
+	for i, c := range s.Positive {
+		res.Positive[i] = c
+	}
+	res.Negative = make(map[int]uint64, len(s.Negative))
+	for i, c := range s.Negative {
+		res.Negative[i] = c
+	}
+	return &res
+}
+
+// Quantile estimates the q-quantile, NaN if there are no observations.
+func (s *Summary) Quantile(q float64) float64 {
+	if s.Count == 0 || q < 0 || q > 1 {
+		return math.NaN()
+	}
+	rank := q * float64(s.Count-1)
+	clamp := func(v float64) float64 {
+		return math.Max(s.Min, math.Min(s.Max, v))
+	}
+
+	var seen float64
+	// the most negative values are in the buckets with the highest index
+	negative := sortedIndexes(s.Negative)
+	for j := len(negative) - 1; j >= 0; j-- {
+		seen += float64(s.Negative[negative[j]])
+		if seen > rank {
+			return clamp(-s.value(negative[j]))
+		}
+	}
+	seen += float64(s.Zero)
+	if seen > rank {
+		return clamp(0)
+	}
+	for _, i := range sortedIndexes(s.Positive) {
+		seen += float64(s.Positive[i])
+		if seen > rank {
+			return clamp(s.value(i))
+		}
+	}
+	return s.Max
+}
+
+// WithQuantiles returns a copy with the estimates of the quantiles filled in.
+func (s *Summary) WithQuantiles(qs []float64) *Summary {
+	res := s.Clone()
+	res.Quantiles = make(map[string]float64, len(qs))
+	for _, q := range qs {
+		if v := s.Quantile(q); !math.IsNaN(v) {
+			res.Quantiles[strconv.FormatFloat(q, 'f', -1, 64)] = v
+		}
+	}
+	return res
+}
+
+func sortedIndexes(buckets map[int]uint64) []int {
+	indexes := make([]int, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+var errNoRecipients = errors.New("no email recipients")
+
+type Email struct {
+	address  string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewEmail(address, username, password, from string, to []string) *Email {
+	return &Email{
+		address:  address,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+func (e *Email) Notify(ctx context.Context, n metrics.Notification) error {
+	if len(e.to) == 0 {
+		return errNoRecipients
+	}
+
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, err := net.SplitHostPort(e.address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	// the rule name comes from the API, encoding it keeps line breaks out of the headers
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject(n)))
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(msg, "Alert %s is %s\r\n", n.RuleID, n.State)
+	fmt.Fprintf(msg, "Metric: %s %s\r\n", n.MType, n.MName)
+	fmt.Fprintf(msg, "Condition: %s %v\r\n", n.Condition, n.Threshold)
+	fmt.Fprintf(msg, "Value: %v\r\n", n.Value)
+	fmt.Fprintf(msg, "Time: %s\r\n", n.Time.Format("2006-01-02 15:04:05 MST"))
+
+	// net/smtp doesn't support contexts, so the send can only be skipped
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return smtp.SendMail(e.address, auth, e.from, e.to, msg.Bytes())
+}
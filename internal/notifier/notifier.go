@@ -0,0 +1,44 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/configuration"
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+const sendTimeout = 10 * time.Second
+
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n metrics.Notification) error
+}
+
+// New builds the notifiers enabled in the configuration.
+func New(l *zerolog.Logger, cfg configuration.Config) []Notifier {
+	var notifiers []Notifier
+	if cfg.WebhookURL != "" {
+		notifiers = append(notifiers, NewWebhook(cfg.WebhookURL, cfg.Key))
+	}
+	if cfg.SMTPAddress != "" {
+		notifiers = append(notifiers, NewEmail(cfg.SMTPAddress, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTo))
+	}
+	if cfg.NotifyFile != "" {
+		notifiers = append(notifiers, NewFile(cfg.NotifyFile))
+	}
+	for _, notifier := range notifiers {
+		l.Info().Str("notifier", notifier.Name()).Msg("Notifier is enabled")
+	}
+	return notifiers
+}
+
+func subject(n metrics.Notification) string {
+	name := n.RuleName
+	if name == "" {
+		name = n.RuleID
+	}
+	return fmt.Sprintf("[%s] %s", n.State, name)
+}
@@ -0,0 +1,182 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+)
+
+// keepDelivered is how long sent and failed deliveries stay visible over the API.
+const keepDelivered = 24 * time.Hour
+
+var errNotConfigured = errors.New("notifier isn't configured")
+
+// Storage persists the deliveries of the queue and records their outcome in
+// the alert history.
+type Storage interface {
+	repository.DeliveryStorage
+	repository.HistoryStorage
+}
+
+// Queue stores every notification before sending it, so notifications aren't
+// lost while a target is down, and retries failed deliveries with exponential backoff.
+type Queue struct {
+	logger      *zerolog.Logger
+	storage     Storage
+	notifiers   map[string]Notifier
+	maxAttempts int
+	wake        chan struct{}
+}
+
+func NewQueue(l *zerolog.Logger, storage Storage, notifiers []Notifier, maxAttempts int) *Queue {
+	byName := make(map[string]Notifier, len(notifiers))
+	for _, n := range notifiers {
+		byName[n.Name()] = n
+	}
+	return &Queue{
+		logger:      l,
+		storage:     storage,
+		notifiers:   byName,
+		maxAttempts: maxAttempts,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores a delivery of the notification for every notifier.
+func (q *Queue) Enqueue(n metrics.Notification) error {
+	now := time.Now()
+	for name := range q.notifiers {
+		d := metrics.Delivery{
+			ID:           metrics.NewID(),
+			Notifier:     name,
+			Notification: n,
+			Status:       metrics.DeliveryPending,
+			NextAttempt:  now,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := q.storage.StoreDelivery(d); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			q.Process(ctx, now)
+		case <-q.wake:
+			q.Process(ctx, time.Now())
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Process sends the pending deliveries that are due.
+func (q *Queue) Process(ctx context.Context, now time.Time) {
+	deliveries, err := q.storage.LoadDeliveries(metrics.DeliveryPending)
+	if err != nil {
+		q.logger.Error().Err(err).Msg("Failed to load pending deliveries")
+		return
+	}
+
+	for _, d := range deliveries {
+		if d.NextAttempt.After(now) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		q.deliver(ctx, d)
+	}
+
+	if err := q.storage.DeleteDeliveries(now.Add(-keepDelivered)); err != nil {
+		q.logger.Error().Err(err).Msg("Failed to delete old deliveries")
+	}
+}
+
+func (q *Queue) deliver(ctx context.Context, d metrics.Delivery) {
+	logger := q.logger.With().
+		Str("delivery", d.ID).
+		Str("notifier", d.Notifier).
+		Str("rule", d.Notification.RuleID).
+		Logger()
+
+	err := errNotConfigured
+	if n, ok := q.notifiers[d.Notifier]; ok {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		err = n.Notify(ctx, d.Notification)
+		cancel()
+	}
+
+	d.Attempts++
+	d.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		d.Status = metrics.DeliverySent
+		d.LastError = ""
+		logger.Info().Msg("Alert notification is sent")
+	case d.Attempts >= q.maxAttempts:
+		d.Status = metrics.DeliveryFailed
+		d.LastError = err.Error()
+		logger.Error().Err(err).Int("attempts", d.Attempts).Msg("Alert notification delivery failed")
+	default:
+		d.LastError = err.Error()
+		d.NextAttempt = d.UpdatedAt.Add(retryInterval(d.Attempts))
+		logger.Info().Err(err).Time("next", d.NextAttempt).Msg("Retrying... alert notification")
+	}
+
+	if err := q.storage.StoreDelivery(d); err != nil {
+		logger.Error().Err(err).Msg("Failed to store delivery")
+	}
+	if d.Status == metrics.DeliveryPending {
+		return
+	}
+
+	event := metrics.AlertEvent{
+		RuleID:   d.Notification.RuleID,
+		Kind:     metrics.EventNotified,
+		State:    d.Notification.State,
+		Value:    d.Notification.Value,
+		Notifier: d.Notifier,
+		Time:     d.UpdatedAt,
+	}
+	if d.Status == metrics.DeliveryFailed {
+		event.Kind = metrics.EventNotifyFailed
+		event.Comment = d.LastError
+	}
+	if err := q.storage.AppendEvent(event); err != nil {
+		logger.Error().Err(err).Msg("Failed to append alert history event")
+	}
+}
+
+// retryInterval returns the delay before the next attempt using the same
+// exponential strategy as the agent.
+func retryInterval(attempts int) time.Duration {
+	expBackOff := backoff.NewExponentialBackOff()
+	expBackOff.MaxElapsedTime = 0
+	expBackOff.MaxInterval = backoff.DefaultMaxInterval
+	expBackOff.InitialInterval = backoff.DefaultInitialInterval
+
+	interval := expBackOff.NextBackOff()
+	for i := 1; i < attempts; i++ {
+		interval = expBackOff.NextBackOff()
+	}
+	return interval
+}
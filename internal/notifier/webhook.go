@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/signature"
+)
+
+// Webhook POSTs the notification as JSON. When the key is set the body is
+// signed the same way agents sign metrics, in the HashSHA256 header.
+type Webhook struct {
+	url    string
+	key    string
+	client *http.Client
+}
+
+func NewWebhook(url, key string) *Webhook {
+	return &Webhook{
+		url:    url,
+		key:    key,
+		client: &http.Client{Timeout: sendTimeout},
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+func (w *Webhook) Notify(ctx context.Context, n metrics.Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if w.key != "" {
+		req.Header.Add("HashSHA256", signature.Sign(n, w.key))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected webhook response status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package pb
+
+import (
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// ToMetric converts an update to the metric stored by the service.
+func ToMetric(m *Metric) metrics.Metric {
+	res := metrics.Metric{
+		ID:           m.GetId(),
+		MType:        m.GetType(),
+		Delta:        m.Delta,
+		Value:        m.Value,
+		Observations: m.GetObservations(),
+		Members:      m.GetMembers(),
+	}
+	if len(m.GetLabels()) > 0 {
+		res.Labels = m.GetLabels()
+	}
+	if h := m.GetHistogram(); h != nil {
+		res.Histogram = &metrics.Histogram{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+	return res
+}
+
+// FromMetric converts a stored metric for responses, sketches are replaced
+// by their estimates like in the JSON /value/ responses.
+func FromMetric(m metrics.Metric) *Metric {
+	res := &Metric{
+		Id:     m.ID,
+		Type:   m.MType,
+		Delta:  m.Delta,
+		Value:  m.Value,
+		Labels: m.Labels,
+	}
+	if m.Histogram != nil {
+		h := m.Histogram.WithQuantiles(metrics.DefaultQuantiles)
+		res.Histogram = &Histogram{
+			Bounds: h.Bounds,
+			Counts: h.Counts,
+			Sum:    h.Sum,
+			Count:  h.Count,
+		}
+		res.Quantiles = h.Quantiles
+	}
+	if m.Summary != nil {
+		s := m.Summary.WithQuantiles(metrics.DefaultQuantiles)
+		res.Quantiles = s.Quantiles
+		res.Count = s.Count
+		res.Sum = s.Sum
+	}
+	if m.Set != nil {
+		res.Cardinality = m.Set.Estimate()
+	}
+	return res
+}
@@ -0,0 +1,4 @@
+// Package pb is the generated code of the gRPC API in proto/metrics.proto.
+package pb
+
+//go:generate protoc --proto_path=../../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
@@ -0,0 +1,17 @@
+package pb
+
+import (
+	"github.com/DieOfCode/go-alert-service/internal/signature"
+	"google.golang.org/protobuf/proto"
+)
+
+// HashMetadata is the metadata key of the request and response signatures of
+// unary calls, the gRPC counterpart of the HashSHA256 header.
+const HashMetadata = "hashsha256"
+
+// SignUpdate returns the signature of the request without its hash.
+func SignUpdate(req *UpdateMetricsRequest, key string) string {
+	unsigned := proto.Clone(req).(*UpdateMetricsRequest)
+	unsigned.Hash = ""
+	return signature.SignMessage(unsigned, key)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/series"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -15,34 +16,101 @@ const maxRetries = 3
 var (
 	ErrParseMetric = errors.New("failed to parse metric: wrong type")
 	ErrStoreData   = errors.New("failed to store data")
+	ErrNotFound    = errors.New("not found")
 )
 
 type Repository struct {
-	logger *zerolog.Logger
-	repo   Storage
+	logger    *zerolog.Logger
+	repo      Storage
+	retention series.Retention
 }
 
 type Storage interface {
-	Load(mtype, mname string) *metrics.Metric
+	// Load returns the series of the metric with exactly the labels,
+	// ErrNotFound if there is none.
+	Load(mtype, mname string, labels map[string]string) (*metrics.Metric, error)
+	// LoadAll returns a snapshot of every series, it doesn't change with
+	// the storage.
 	LoadAll() metrics.Data
 	Store(m metrics.Metric) error
 	StoreMetrics(m []metrics.Metric) error
 	RestoreFromFile() error
 	WriteToFile() error
+	SampleStorage
+	RollupStorage
 }
 
-func New(l *zerolog.Logger, repo Storage) *Repository {
+// AlertStorage persists alert states next to the metric data.
+type AlertStorage interface {
+	LoadAlerts() ([]metrics.Alert, error)
+	StoreAlert(a metrics.Alert) error
+	DeleteAlert(ruleID string) error
+}
+
+// RuleStorage persists alert rules managed over the API.
+type RuleStorage interface {
+	LoadRules() ([]metrics.AlertRule, error)
+	LoadRule(id string) (*metrics.AlertRule, error)
+	StoreRule(r metrics.AlertRule) error
+	DeleteRule(id string) error
+}
+
+// DeliveryStorage persists the outgoing notification queue.
+type DeliveryStorage interface {
+	// LoadDeliveries returns the deliveries with the status, all of them if the status is empty.
+	LoadDeliveries(status string) ([]metrics.Delivery, error)
+	LoadDelivery(id string) (*metrics.Delivery, error)
+	StoreDelivery(d metrics.Delivery) error
+	// DeleteDeliveries removes sent and failed deliveries last updated before the time.
+	DeleteDeliveries(before time.Time) error
+}
+
+// SilenceStorage persists silences and maintenance windows.
+type SilenceStorage interface {
+	LoadSilences() ([]metrics.Silence, error)
+	LoadSilence(id string) (*metrics.Silence, error)
+	StoreSilence(s metrics.Silence) error
+	DeleteSilence(id string) error
+}
+
+// HistoryStorage persists the append-only alert history. The in-memory
+// storage keeps the latest events only, up to -alert-history-limit.
+type HistoryStorage interface {
+	AppendEvent(e metrics.AlertEvent) error
+	// LoadEvents returns the events in [from, to) ordered by time, of all
+	// rules if ruleID is empty.
+	LoadEvents(ruleID string, from, to time.Time) ([]metrics.AlertEvent, error)
+}
+
+// SampleStorage keeps the timestamped samples of every series.
+type SampleStorage interface {
+	// LoadSamples returns the samples in [from, to) ordered by time.
+	LoadSamples(mtype, mname string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error)
+}
+
+// RollupStorage keeps the downsampled series and drops the expired data.
+type RollupStorage interface {
+	// Rollup aggregates the data of the source resolution in [from, to) into
+	// buckets of the resolution, replacing the buckets computed before.
+	Rollup(resolution, source time.Duration, from, to time.Time) error
+	// LoadRollups returns the buckets starting in [from, to) ordered by time.
+	LoadRollups(mtype, mname string, labels map[string]string, resolution time.Duration, from, to time.Time) ([]metrics.Rollup, error)
+	DeleteSamples(before time.Time) error
+	DeleteRollups(resolution time.Duration, before time.Time) error
+}
+
+func New(l *zerolog.Logger, repo Storage, retention series.Retention) *Repository {
 	return &Repository{
-		logger: l,
-		repo:   repo,
+		logger:    l,
+		repo:      repo,
+		retention: retention,
 	}
 }
 
-func (s *Repository) GetMetric(mtype, mname string) (*metrics.Metric, error) {
-	m := s.repo.Load(mtype, mname)
-
-	if m == nil {
-		return nil, fmt.Errorf("failed to load metric %s", mname)
+func (s *Repository) GetMetric(mtype, mname string, labels map[string]string) (*metrics.Metric, error) {
+	m, err := s.repo.Load(mtype, mname, labels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metric %s: %w", metrics.SeriesKey(mname, labels), err)
 	}
 
 	return m, nil
@@ -92,6 +160,76 @@ func (s *Repository) SaveMetrics(m []metrics.Metric) error {
 	return nil
 }
 
+// GetHistory returns the series data in the query range aggregated per step.
+// The data is read from the finest resolution that is still retained at the
+// beginning of the range, and from the minute rollups where the samples
+// limit kept less raw data.
+func (s *Repository) GetHistory(q metrics.RangeQuery) (*metrics.History, error) {
+	// the first step starts before from when from isn't aligned
+	from := q.From
+	if q.Step > 0 {
+		from = from.Truncate(q.Step)
+	}
+
+	rollups, resolution, err := s.loadRollups(q.MType, q.ID, q.Labels, s.retention.Resolution(from, time.Now()), from, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := series.Align(rollups, from, q.To, q.Step, q.Agg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metrics.History{
+		ID:         q.ID,
+		MType:      q.MType,
+		Labels:     q.Labels,
+		Agg:        q.Agg,
+		Step:       q.Step.String(),
+		Resolution: resolution.String(),
+		Points:     points,
+	}, nil
+}
+
+func (s *Repository) loadRollups(mtype, mname string, labels map[string]string, resolution time.Duration, from, to time.Time) ([]metrics.Rollup, time.Duration, error) {
+	tail := from
+	var rollups []metrics.Rollup
+	if resolution != series.Raw {
+		var err error
+		rollups, err = s.repo.LoadRollups(mtype, mname, labels, resolution, from, to)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load rollups: %w", err)
+		}
+		if len(rollups) > 0 {
+			tail = rollups[len(rollups)-1].Time.Add(resolution)
+		}
+	}
+
+	// the samples that aren't rolled up yet
+	samples, err := s.repo.LoadSamples(mtype, mname, labels, tail, to)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load samples: %w", err)
+	}
+
+	if resolution == series.Raw && (len(samples) == 0 || samples[0].Time.After(from)) {
+		// the samples limit may keep less than the raw retention, the range
+		// before the oldest sample is read from the minute rollups
+		head := to
+		if len(samples) > 0 {
+			head = samples[0].Time.Truncate(series.Minute)
+		}
+		rollups, err = s.repo.LoadRollups(mtype, mname, labels, series.Minute, from, head)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to load rollups: %w", err)
+		}
+		if len(rollups) > 0 {
+			resolution = series.Minute
+		}
+	}
+	return append(rollups, series.FromSamples(samples)...), resolution, nil
+}
+
 func (s *Repository) Retry(maxRetries int, fn func() error, intervals ...time.Duration) error {
 	var err error
 	err = fn()
@@ -99,6 +237,10 @@ func (s *Repository) Retry(maxRetries int, fn func() error, intervals ...time.Du
 		return nil
 	}
 	for i := 0; i < maxRetries; i++ {
+		// invalid data fails the same way on every attempt
+		if errors.Is(err, ErrParseMetric) {
+			return err
+		}
 		s.logger.Info().Msgf("Retrying... (Attempt %d)", i+1)
 		time.Sleep(intervals[i])
 		if err = fn(); err == nil {
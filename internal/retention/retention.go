@@ -0,0 +1,105 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/DieOfCode/go-alert-service/internal/series"
+	"github.com/rs/zerolog"
+)
+
+type level struct {
+	resolution time.Duration
+	source     time.Duration
+}
+
+// levels are computed in order, every level is rolled up from the previous one.
+var levels = []level{
+	{resolution: series.Minute, source: series.Raw},
+	{resolution: series.Hour, source: series.Minute},
+}
+
+// Job computes the rollups of complete buckets and deletes the data older
+// than its retention.
+type Job struct {
+	logger    *zerolog.Logger
+	storage   repository.RollupStorage
+	retention series.Retention
+	// rolledUp is the end of the data rolled up for every resolution so far
+	rolledUp map[time.Duration]time.Time
+}
+
+func New(l *zerolog.Logger, storage repository.RollupStorage, retention series.Retention) *Job {
+	return &Job{
+		logger:    l,
+		storage:   storage,
+		retention: retention,
+		rolledUp:  make(map[time.Duration]time.Time),
+	}
+}
+
+func (j *Job) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case now := <-ticker.C:
+			j.Process(now)
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+func (j *Job) Process(now time.Time) {
+	for _, l := range levels {
+		to := now.Truncate(l.resolution)
+		from, ok := j.rolledUp[l.resolution]
+		if !ok {
+			// after a start everything still retained at the source resolution is rolled up again
+			from = time.Time{}
+			if keep := j.keep(l.source); keep > 0 {
+				from = to.Add(-keep)
+			}
+		} else {
+			// the last bucket is recomputed for late samples
+			from = from.Add(-l.resolution)
+		}
+		if !to.After(from) {
+			continue
+		}
+
+		if err := j.storage.Rollup(l.resolution, l.source, from, to); err != nil {
+			j.logger.Error().Err(err).Str("resolution", l.resolution.String()).Msg("Failed to compute rollups")
+			continue
+		}
+		j.rolledUp[l.resolution] = to
+	}
+
+	if j.retention.Raw > 0 {
+		if err := j.storage.DeleteSamples(now.Add(-j.retention.Raw)); err != nil {
+			j.logger.Error().Err(err).Msg("Failed to delete expired samples")
+		}
+	}
+	for _, l := range levels {
+		keep := j.keep(l.resolution)
+		if keep == 0 {
+			continue
+		}
+		if err := j.storage.DeleteRollups(l.resolution, now.Add(-keep)); err != nil {
+			j.logger.Error().Err(err).Str("resolution", l.resolution.String()).Msg("Failed to delete expired rollups")
+		}
+	}
+}
+
+func (j *Job) keep(resolution time.Duration) time.Duration {
+	switch resolution {
+	case series.Raw:
+		return j.retention.Raw
+	case series.Minute:
+		return j.retention.Minute
+	}
+	return j.retention.Hour
+}
@@ -0,0 +1,28 @@
+package series
+
+import "time"
+
+// Resolutions of the stored data.
+const (
+	Raw    time.Duration = 0
+	Minute               = time.Minute
+	Hour                 = time.Hour
+)
+
+// Retention is how long the data of every resolution is kept, zero keeps it forever.
+type Retention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// Resolution returns the finest resolution that still has data at from.
+func (r Retention) Resolution(from, now time.Time) time.Duration {
+	switch {
+	case r.Raw == 0 || !from.Before(now.Add(-r.Raw)):
+		return Raw
+	case r.Minute == 0 || !from.Before(now.Add(-r.Minute)):
+		return Minute
+	}
+	return Hour
+}
@@ -0,0 +1,149 @@
+package series
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// maxPoints bounds the number of steps a single query can return.
+const maxPoints = 11000
+
+var ErrInvalidQuery = errors.New("invalid range query")
+
+func Validate(q metrics.RangeQuery) error {
+	if !q.To.After(q.From) {
+		return fmt.Errorf("%w: to has to be after from", ErrInvalidQuery)
+	}
+	if q.Step < 0 {
+		return fmt.Errorf("%w: step can't be negative", ErrInvalidQuery)
+	}
+	if q.Step > 0 && q.To.Sub(q.From)/q.Step > maxPoints {
+		return fmt.Errorf("%w: more than %d points requested", ErrInvalidQuery, maxPoints)
+	}
+	switch q.Agg {
+	case "", metrics.AggAvg, metrics.AggMin, metrics.AggMax, metrics.AggLast, metrics.AggSum:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown aggregation %q", ErrInvalidQuery, q.Agg)
+}
+
+// DefaultAgg returns the aggregation used when the query doesn't set one:
+// the running totals of counters, histograms, summaries and sets are best
+// represented by their last value.
+func DefaultAgg(mtype string) string {
+	switch mtype {
+	case metrics.TypeCounter, metrics.TypeHistogram, metrics.TypeSummary, metrics.TypeSet:
+		return metrics.AggLast
+	}
+	return metrics.AggAvg
+}
+
+// FromSamples represents every raw sample as a single value rollup.
+func FromSamples(samples []metrics.Sample) []metrics.Rollup {
+	rollups := make([]metrics.Rollup, 0, len(samples))
+	for _, s := range samples {
+		rollups = append(rollups, metrics.Rollup{
+			Time:  s.Time,
+			Min:   s.Value,
+			Max:   s.Value,
+			Sum:   s.Value,
+			Count: 1,
+			Last:  s.Value,
+		})
+	}
+	return rollups
+}
+
+// Align aggregates the time ordered rollups into step wide buckets aligned to
+// multiples of the step. A zero step returns a point per rollup.
+func Align(rollups []metrics.Rollup, from, to time.Time, step time.Duration, agg string) ([]metrics.Point, error) {
+	if step == 0 {
+		points := make([]metrics.Point, 0, len(rollups))
+		for i := range rollups {
+			v, err := Aggregate(rollups[i:i+1], agg)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, metrics.Point{Time: rollups[i].Time, Value: &v})
+		}
+		return points, nil
+	}
+
+	points := []metrics.Point{}
+	i := 0
+	for start := from.Truncate(step); start.Before(to); start = start.Add(step) {
+		end := start.Add(step)
+		for i < len(rollups) && rollups[i].Time.Before(start) {
+			i++
+		}
+		j := i
+		for j < len(rollups) && rollups[j].Time.Before(end) {
+			j++
+		}
+
+		p := metrics.Point{Time: start}
+		if j > i {
+			v, err := Aggregate(rollups[i:j], agg)
+			if err != nil {
+				return nil, err
+			}
+			p.Value = &v
+		}
+		points = append(points, p)
+		i = j
+	}
+	return points, nil
+}
+
+// Aggregate reduces non-empty time ordered rollups to a single value.
+func Aggregate(rollups []metrics.Rollup, agg string) (float64, error) {
+	switch agg {
+	case metrics.AggLast:
+		return rollups[len(rollups)-1].Last, nil
+	case metrics.AggMin, metrics.AggMax, metrics.AggSum, metrics.AggAvg:
+		r := Merge(rollups)
+		switch agg {
+		case metrics.AggMin:
+			return r.Min, nil
+		case metrics.AggMax:
+			return r.Max, nil
+		case metrics.AggSum:
+			return r.Sum, nil
+		}
+		return r.Sum / float64(r.Count), nil
+	}
+	return 0, fmt.Errorf("%w: unknown aggregation %q", ErrInvalidQuery, agg)
+}
+
+// Merge combines non-empty time ordered rollups into one starting at the first of them.
+func Merge(rollups []metrics.Rollup) metrics.Rollup {
+	res := rollups[0]
+	for _, r := range rollups[1:] {
+		res.Min = min(res.Min, r.Min)
+		res.Max = max(res.Max, r.Max)
+		res.Sum += r.Sum
+		res.Count += r.Count
+		res.Last = r.Last
+	}
+	return res
+}
+
+// Rollup groups the time ordered rollups into buckets of the resolution.
+func Rollup(rollups []metrics.Rollup, resolution time.Duration) []metrics.Rollup {
+	var res []metrics.Rollup
+	for i := 0; i < len(rollups); {
+		bucket := rollups[i].Time.Truncate(resolution)
+		j := i
+		for j < len(rollups) && rollups[j].Time.Truncate(resolution).Equal(bucket) {
+			j++
+		}
+		r := Merge(rollups[i:j])
+		r.Time = bucket
+		res = append(res, r)
+		i = j
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Sign returns the hex encoded HMAC-SHA256 of the JSON representation of v.
+func Sign(v any, key string) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return SignBytes(b, key)
+}
+
+// SignMessage returns the hex encoded HMAC-SHA256 of the deterministic
+// protobuf encoding of m.
+func SignMessage(m proto.Message, key string) string {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return SignBytes(b, key)
+}
+
+// SignBytes returns the hex encoded HMAC-SHA256 of b.
+func SignBytes(b []byte, key string) string {
+	h1 := hmac.New(sha256.New, []byte(key))
+	h1.Write(b)
+	d := h1.Sum(nil)
+	return hex.EncodeToString(d)
+}
+
+// Equal compares two hex encoded signatures in constant time.
+func Equal(a, b string) bool {
+	da, err := hex.DecodeString(a)
+	if err != nil {
+		return false
+	}
+	db, err := hex.DecodeString(b)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(da, db)
+}
@@ -0,0 +1,436 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+const (
+	batchExt = ".json"
+	// carryFile keeps the counter deltas of the evicted batches until they
+	// are sent with the next one.
+	carryFile = "carry.json"
+)
+
+// ErrRejected marks the errors of batches the server won't ever accept, they
+// are dropped instead of blocking the spool.
+var ErrRejected = errors.New("batch rejected")
+
+// Record is a batch of metrics waiting to be sent.
+type Record struct {
+	Time    time.Time             `json:"time"`
+	Metrics []metrics.AgentMetric `json:"metrics"`
+}
+
+type entry struct {
+	seq  uint64
+	time time.Time
+	size int64
+}
+
+func (e entry) name() string {
+	return fmt.Sprintf("%020d-%d%s", e.seq, e.time.UnixNano(), batchExt)
+}
+
+// Spool is a write-ahead queue of the batches the agent couldn't send yet,
+// every batch is a file in the directory so it survives restarts. Batches
+// are replayed in order and removed once they are sent. The oldest batches
+// are evicted when the spool exceeds its size or age cap, their gauges are
+// stale and dropped, their counter deltas are carried over to the next batch
+// sent so no increment is lost.
+//
+// Delivery is at least once: the batch and the carried counters being sent
+// are removed only after send returns, so when the agent crashes after the
+// server stored them but before they are removed, they are sent and counted
+// again on the next start. The server can't tell the batches apart.
+type Spool struct {
+	logger  *zerolog.Logger
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	labels  map[string]string
+
+	// replay serializes the replays, so the batches are sent in order
+	replay sync.Mutex
+
+	mu      sync.Mutex
+	entries []entry
+	size    int64
+	nextSeq uint64
+	carry   map[string]metrics.AgentMetric
+	// sending are the carried counters of the batch being sent
+	sending map[string]metrics.AgentMetric
+	// inflight is set while the first batch is being sent
+	inflight bool
+	// dropped and replayed are the batches since the spool metrics were last sent
+	dropped  int64
+	replayed int64
+}
+
+// Open loads the batches left in the directory, it is created if needed.
+// A maxSize or maxAge that isn't positive disables the cap.
+func Open(l *zerolog.Logger, dir string, maxSize int64, maxAge time.Duration, labels map[string]string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		logger:  l,
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		labels:  labels,
+		nextSeq: 1,
+		carry:   make(map[string]metrics.AgentMetric),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		e, ok := parseName(f.Name())
+		if !ok {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		e.size = info.Size()
+		s.entries = append(s.entries, e)
+		s.size += e.size
+		if e.seq >= s.nextSeq {
+			s.nextSeq = e.seq + 1
+		}
+	}
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].seq < s.entries[j].seq })
+
+	b, err := os.ReadFile(filepath.Join(dir, carryFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &s.carry); err != nil {
+			s.logger.Error().Err(err).Msg("Spooled counters are corrupted and dropped")
+		}
+	}
+	return s, nil
+}
+
+// parseName parses seq-unixnano.json.
+func parseName(name string) (entry, bool) {
+	base, ok := strings.CutSuffix(name, batchExt)
+	if !ok {
+		return entry{}, false
+	}
+	seq, ts, ok := strings.Cut(base, "-")
+	if !ok {
+		return entry{}, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	nsec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return entry{}, false
+	}
+	return entry{seq: n, time: time.Unix(0, nsec)}, true
+}
+
+// Append writes the batch at the end of the spool.
+func (s *Spool) Append(batch []metrics.AgentMetric) error {
+	now := time.Now()
+	b, err := json.Marshal(Record{Time: now, Metrics: batch})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := entry{seq: s.nextSeq, time: now, size: int64(len(b))}
+	if err := writeFile(filepath.Join(s.dir, e.name()), b); err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.entries = append(s.entries, e)
+	s.size += e.size
+	s.trim(now)
+	return nil
+}
+
+// Replay sends the spooled batches in order until the spool is empty or
+// send fails, it returns the error of send. Batches failing with ErrRejected
+// are dropped, the counters carried with them are kept for the next one. The
+// metrics of the spool are sent with every batch.
+func (s *Spool) Replay(send func(batch []metrics.AgentMetric) error) error {
+	s.replay.Lock()
+	defer s.replay.Unlock()
+
+	for {
+		s.mu.Lock()
+		s.trim(time.Now())
+		if len(s.entries) == 0 && len(s.carry) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		var batch []metrics.AgentMetric
+		if len(s.entries) > 0 {
+			head := s.entries[0]
+			r, err := s.read(head)
+			if err != nil {
+				s.logger.Error().Err(err).Str("file", head.name()).Msg("Spooled batch is corrupted and dropped")
+				s.remove(head)
+				s.dropped++
+				s.mu.Unlock()
+				continue
+			}
+			// the batch being sent isn't evicted
+			s.inflight = true
+			batch = r.Metrics
+		}
+		carried := s.carry
+		s.sending, s.carry = carried, make(map[string]metrics.AgentMetric)
+		batch = coalesce(batch, carried)
+		dropped, replayed := s.dropped, s.replayed
+		batch = append(batch, s.metrics(time.Now())...)
+		s.mu.Unlock()
+
+		err := send(batch)
+
+		s.mu.Lock()
+		switch {
+		case errors.Is(err, ErrRejected):
+			s.logger.Error().Err(err).Msg("Spooled batch is rejected and dropped")
+			// the carried counters go with the next batch, unless they were
+			// all the batch and so the ones rejected
+			if s.inflight {
+				s.remove(s.entries[0])
+				for k, m := range carried {
+					s.carry[k] = addDelta(s.carry[k], m)
+				}
+			}
+			s.dropped++
+			err = nil
+		case err != nil:
+			// the counters are carried over again with the ones evicted meanwhile
+			for k, m := range carried {
+				s.carry[k] = addDelta(s.carry[k], m)
+			}
+		default:
+			if s.inflight {
+				s.remove(s.entries[0])
+				s.replayed++
+			}
+			s.dropped -= dropped
+			s.replayed -= replayed
+		}
+		s.inflight, s.sending = false, nil
+		if err := s.saveCarry(); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to write the spooled counters")
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// trim evicts the oldest batches beyond the caps. It expects the caller to
+// hold the lock.
+func (s *Spool) trim(now time.Time) {
+	first := 0
+	if s.inflight {
+		first = 1
+	}
+	var evicted bool
+	for len(s.entries) > first {
+		e := s.entries[first]
+		tooBig := s.maxSize > 0 && s.size > s.maxSize
+		tooOld := s.maxAge > 0 && now.Sub(e.time) > s.maxAge
+		if !tooBig && !tooOld {
+			break
+		}
+		if r, err := s.read(e); err == nil {
+			for _, m := range r.Metrics {
+				if m.MType == metrics.TypeCounter {
+					k := key(m)
+					s.carry[k] = addDelta(s.carry[k], m)
+				}
+			}
+		} else {
+			s.logger.Error().Err(err).Str("file", e.name()).Msg("Spooled batch is corrupted and dropped")
+		}
+		s.removeAt(first)
+		s.dropped++
+		evicted = true
+	}
+	if evicted {
+		if err := s.saveCarry(); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to write the spooled counters")
+		}
+	}
+}
+
+func (s *Spool) read(e entry) (*Record, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, e.name()))
+	if err != nil {
+		return nil, err
+	}
+	var r Record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *Spool) remove(e entry) {
+	for i := range s.entries {
+		if s.entries[i].seq == e.seq {
+			s.removeAt(i)
+			return
+		}
+	}
+}
+
+func (s *Spool) removeAt(i int) {
+	e := s.entries[i]
+	if err := os.Remove(filepath.Join(s.dir, e.name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Error().Err(err).Str("file", e.name()).Msg("Failed to remove spooled batch")
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	s.size -= e.size
+}
+
+// saveCarry writes the carried counters including the ones being sent, so
+// they survive a crash before the send is confirmed.
+func (s *Spool) saveCarry() error {
+	path := filepath.Join(s.dir, carryFile)
+	all := make(map[string]metrics.AgentMetric, len(s.carry)+len(s.sending))
+	for k, m := range s.sending {
+		all[k] = m
+	}
+	for k, m := range s.carry {
+		all[k] = addDelta(all[k], m)
+	}
+	if len(all) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, b)
+}
+
+// Metrics of the spool, they are sent with every batch.
+func (s *Spool) metrics(now time.Time) []metrics.AgentMetric {
+	var age float64
+	if len(s.entries) > 0 {
+		age = now.Sub(s.entries[0].time).Seconds()
+	}
+	return []metrics.AgentMetric{
+		{MType: metrics.TypeGauge, ID: "SpoolBatches", Value: float64(len(s.entries)), Labels: s.labels},
+		{MType: metrics.TypeGauge, ID: "SpoolBytes", Value: float64(s.size), Labels: s.labels},
+		{MType: metrics.TypeGauge, ID: "SpoolOldestAge", Value: age, Labels: s.labels},
+		{MType: metrics.TypeCounter, ID: "SpoolDropped", Delta: s.dropped, Labels: s.labels},
+		{MType: metrics.TypeCounter, ID: "SpoolReplayed", Delta: s.replayed, Labels: s.labels},
+	}
+}
+
+// coalesce adds the carried counter deltas to the counters of the batch,
+// the others are appended.
+func coalesce(batch []metrics.AgentMetric, carried map[string]metrics.AgentMetric) []metrics.AgentMetric {
+	if len(carried) == 0 {
+		return batch
+	}
+	res := make([]metrics.AgentMetric, 0, len(batch)+len(carried))
+	merged := make(map[string]bool, len(carried))
+	for _, m := range batch {
+		if m.MType == metrics.TypeCounter {
+			k := key(m)
+			if c, ok := carried[k]; ok && !merged[k] {
+				m = addDelta(m, c)
+				merged[k] = true
+			}
+		}
+		res = append(res, m)
+	}
+	keys := make([]string, 0, len(carried))
+	for k := range carried {
+		if !merged[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		res = append(res, carried[k])
+	}
+	return res
+}
+
+func key(m metrics.AgentMetric) string {
+	return metrics.SeriesKey(m.ID, m.Labels)
+}
+
+// addDelta returns the counter m with the delta of o added, o itself if m
+// is empty.
+func addDelta(m, o metrics.AgentMetric) metrics.AgentMetric {
+	if m.ID == "" {
+		return o
+	}
+	m.Delta = int64(toFloat(m.Delta) + toFloat(o.Delta))
+	return m
+}
+
+// toFloat converts the deltas, they are float64 once loaded from JSON.
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return 0
+}
+
+// writeFile writes the file atomically, so a crash never leaves a partial batch.
+func writeFile(path string, b []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,229 @@
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/rs/zerolog"
+)
+
+var errUnavailable = errors.New("server unavailable")
+
+func openSpool(t *testing.T, dir string) *Spool {
+	t.Helper()
+	l := zerolog.Nop()
+	s, err := Open(&l, dir, 0, 0, nil)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return s
+}
+
+func batch(delta int64, value float64) []metrics.AgentMetric {
+	return []metrics.AgentMetric{
+		{MType: metrics.TypeCounter, ID: "PollCount", Delta: delta},
+		{MType: metrics.TypeGauge, ID: "RandomValue", Value: value},
+	}
+}
+
+// appendBatches appends the batches with PollCount deltas, the spool keeps
+// only the last one and carries the counters of the others.
+func appendBatches(t *testing.T, s *Spool, deltas ...int64) {
+	t.Helper()
+	for i, d := range deltas {
+		if err := s.Append(batch(d, float64(i))); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if i == 0 {
+			// every batch has the same size
+			s.maxSize = s.size
+		}
+	}
+}
+
+// sent returns the PollCount delta and the RandomValue gauges of the batch.
+func sent(batch []metrics.AgentMetric) (float64, []float64) {
+	var delta float64
+	var values []float64
+	for _, m := range batch {
+		switch m.ID {
+		case "PollCount":
+			delta += toFloat(m.Delta)
+		case "RandomValue":
+			values = append(values, toFloat(m.Value))
+		}
+	}
+	return delta, values
+}
+
+func TestSpool_TrimCarry(t *testing.T) {
+	s := openSpool(t, t.TempDir())
+	appendBatches(t, s, 1, 2, 4)
+
+	if len(s.entries) != 1 {
+		t.Fatalf("spool has %d batches, want 1", len(s.entries))
+	}
+	if got := toFloat(s.carry[key(batch(0, 0)[0])].Delta); got != 3 {
+		t.Errorf("carried PollCount = %v, want 3", got)
+	}
+
+	var batches [][]metrics.AgentMetric
+	err := s.Replay(func(b []metrics.AgentMetric) error {
+		batches = append(batches, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(batches) != 1 {
+		t.Fatalf("Replay() sent %d batches, want 1", len(batches))
+	}
+	delta, values := sent(batches[0])
+	if delta != 7 {
+		t.Errorf("sent PollCount = %v, want 7", delta)
+	}
+	// the gauges of the evicted batches are stale
+	if len(values) != 1 || values[0] != 2 {
+		t.Errorf("sent RandomValue = %v, want [2]", values)
+	}
+	if len(s.entries) != 0 || len(s.carry) != 0 {
+		t.Errorf("spool isn't empty after Replay(): %d batches, %d carried", len(s.entries), len(s.carry))
+	}
+	if _, err := os.Stat(filepath.Join(s.dir, carryFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("carried counters file is left after Replay(): %v", err)
+	}
+}
+
+func TestSpool_ReplayCarriedCounters(t *testing.T) {
+	tests := []struct {
+		name string
+		// first is the error of the first send
+		first error
+		// wantErr is whether the first Replay fails
+		wantErr bool
+		// want is the PollCount accepted once a batch with delta 8 is
+		// appended and replayed too
+		want float64
+	}{
+		{
+			name:    "rejected",
+			first:   ErrRejected,
+			wantErr: false,
+			// the rejected batch is dropped, its carried counters aren't
+			want: 3 + 8,
+		},
+		{
+			name:    "failed",
+			first:   errUnavailable,
+			wantErr: true,
+			want:    3 + 4 + 8,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openSpool(t, t.TempDir())
+			appendBatches(t, s, 1, 2, 4)
+
+			var sends int
+			var total float64
+			send := func(b []metrics.AgentMetric) error {
+				sends++
+				delta, _ := sent(b)
+				if sends == 1 {
+					if delta != 3+4 {
+						t.Errorf("first sent PollCount = %v, want 7", delta)
+					}
+					return tt.first
+				}
+				total += delta
+				return nil
+			}
+
+			if err := s.Replay(send); (err != nil) != tt.wantErr {
+				t.Fatalf("Replay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			s.maxSize = 0
+			if err := s.Append(batch(8, 0)); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+			if err := s.Replay(send); err != nil {
+				t.Fatalf("Replay() error = %v", err)
+			}
+			if total != tt.want {
+				t.Errorf("accepted PollCount = %v, want %v", total, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpool_ReplayRejectedCarryOnly(t *testing.T) {
+	s := openSpool(t, t.TempDir())
+	appendBatches(t, s, 1, 2)
+	s.removeAt(0)
+
+	var sends int
+	err := s.Replay(func(b []metrics.AgentMetric) error {
+		sends++
+		return ErrRejected
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	// the carried counters were the whole batch, they are dropped
+	if sends != 1 || len(s.carry) != 0 {
+		t.Errorf("Replay() sent %d batches and kept %d counters, want 1 and 0", sends, len(s.carry))
+	}
+}
+
+func TestSpool_ReopenAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	s := openSpool(t, dir)
+	appendBatches(t, s, 1, 2, 4)
+	// a write interrupted by the crash
+	if err := os.WriteFile(filepath.Join(dir, "00000000000000000009-1.json.tmp"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent crashes while the batch is being sent
+	var reopened *Spool
+	err := s.Replay(func(b []metrics.AgentMetric) error {
+		reopened = openSpool(t, dir)
+		return errUnavailable
+	})
+	if !errors.Is(err, errUnavailable) {
+		t.Fatalf("Replay() error = %v, want %v", err, errUnavailable)
+	}
+
+	if len(reopened.entries) != 1 {
+		t.Fatalf("reopened spool has %d batches, want 1", len(reopened.entries))
+	}
+	reopened.maxSize = 0
+	if err := reopened.Append(batch(8, 3)); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if last := reopened.entries[len(reopened.entries)-1]; last.seq <= reopened.entries[0].seq {
+		t.Errorf("appended batch seq %d isn't after %d", last.seq, reopened.entries[0].seq)
+	}
+
+	var total float64
+	var values []float64
+	err = reopened.Replay(func(b []metrics.AgentMetric) error {
+		delta, v := sent(b)
+		total += delta
+		values = append(values, v...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	// the batch unconfirmed by the crash is sent again with its carried counters
+	if total != 1+2+4+8 {
+		t.Errorf("sent PollCount = %v, want 15", total)
+	}
+	if len(values) != 2 || values[0] != 2 || values[1] != 3 {
+		t.Errorf("sent RandomValue = %v, want [2 3]", values)
+	}
+}
@@ -0,0 +1,281 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/rs/zerolog"
+)
+
+// maxPacketSize is the largest UDP payload, clients keep their packets well
+// below it to avoid fragmentation.
+const maxPacketSize = 65535
+
+// DefaultFlushInterval is used when the configured interval isn't positive.
+const DefaultFlushInterval = 10 * time.Second
+
+type Service interface {
+	GetMetric(mtype, mname string, labels map[string]string) (*metrics.Metric, error)
+	SaveMetrics(m []metrics.Metric) error
+}
+
+type counter struct {
+	metric metrics.Metric
+	// value is the sum of the increments not stored yet, the stored counters
+	// are integers so the fraction is carried over to the next flush
+	value float64
+}
+
+type gauge struct {
+	metric metrics.Metric
+	value  float64
+}
+
+type timer struct {
+	metric  metrics.Metric
+	summary *metrics.Summary
+}
+
+// Listener receives StatsD lines over UDP and stores them once per flush
+// interval: the sum of the counter increments, the last gauge value and a
+// summary of the timings. The aggregates that couldn't be stored are kept
+// for the next flush.
+type Listener struct {
+	logger   *zerolog.Logger
+	service  Service
+	conn     net.PacketConn
+	interval time.Duration
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	// last is the value of every gauge seen, relative gauge updates are
+	// applied to it
+	last map[string]float64
+}
+
+// Listen opens the UDP socket, the lines are received once Serve is called.
+func Listen(l *zerolog.Logger, addr string, srv Service, interval time.Duration) (*Listener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Listener{
+		logger:   l,
+		service:  srv,
+		conn:     conn,
+		interval: interval,
+		counters: make(map[string]*counter),
+		gauges:   make(map[string]*gauge),
+		timers:   make(map[string]*timer),
+		last:     make(map[string]float64),
+	}, nil
+}
+
+// Serve receives and flushes the lines until the context is done, then
+// closes the socket and flushes what was received since the last flush.
+func (s *Listener) Serve(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.receive()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(s.interval)
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-ctx.Done():
+			ticker.Stop()
+			s.conn.Close()
+			<-done
+			s.Flush()
+			return
+		}
+	}
+}
+
+func (s *Listener) receive() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Error().Err(err).Msg("Failed to read StatsD packet")
+			}
+			return
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			l, err := ParseLine(line)
+			if err != nil {
+				s.logger.Warn().Err(err).Msg("Invalid incoming data")
+				continue
+			}
+			s.Add(l)
+		}
+	}
+}
+
+// Add aggregates a line into the current flush interval.
+func (s *Listener) Add(l *Line) {
+	m := metrics.Metric{ID: l.Name, Labels: l.Labels}
+	key := m.Key()
+
+	// the stored value a relative gauge update starts from is read without
+	// the lock, which the receive loop and the flushes wait for
+	var stored *float64
+	if l.Type == typeGauge && l.Relative {
+		s.mu.Lock()
+		_, ok := s.last[key]
+		s.mu.Unlock()
+		if !ok {
+			stored = s.storedGauge(m)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch l.Type {
+	case typeCounter:
+		c, ok := s.counters[key]
+		if !ok {
+			m.MType = metrics.TypeCounter
+			c = &counter{metric: m}
+			s.counters[key] = c
+		}
+		c.value += l.Value / l.Rate
+	case typeGauge:
+		m.MType = metrics.TypeGauge
+		value := l.Value
+		if l.Relative {
+			if last, ok := s.last[key]; ok {
+				value += last
+			} else if stored != nil {
+				value += *stored
+			}
+		}
+		s.last[key] = value
+		s.gauges[key] = &gauge{metric: m, value: value}
+	case typeTimer:
+		t, ok := s.timers[key]
+		if !ok {
+			m.MType = metrics.TypeSummary
+			t = &timer{metric: m, summary: metrics.NewSummary()}
+			s.timers[key] = t
+		}
+		// the timings are a sample already, the rate doesn't change the quantiles
+		t.summary.Observe(l.Value)
+	}
+}
+
+// storedGauge returns the stored value of a gauge the listener hasn't seen
+// since it started, nil if there is none.
+func (s *Listener) storedGauge(m metrics.Metric) *float64 {
+	stored, err := s.service.GetMetric(metrics.TypeGauge, m.ID, m.Labels)
+	if err != nil {
+		return nil
+	}
+	return stored.Value
+}
+
+// Flush stores the metrics aggregated since the last flush. They are stored
+// one by one, so an invalid series is dropped alone and the ones left after
+// a failure are known exactly and kept for the next flush.
+func (s *Listener) Flush() {
+	s.mu.Lock()
+	counters, gauges, timers := s.counters, s.gauges, s.timers
+	s.counters = make(map[string]*counter)
+	s.gauges = make(map[string]*gauge)
+	s.timers = make(map[string]*timer)
+	s.mu.Unlock()
+
+	res := make([]metrics.Metric, 0, len(counters)+len(gauges)+len(timers))
+	for _, c := range counters {
+		whole := math.Trunc(c.value)
+		if whole == 0 {
+			continue
+		}
+		delta := int64(whole)
+		m := c.metric
+		m.Delta = &delta
+		res = append(res, m)
+	}
+	for _, g := range gauges {
+		value := g.value
+		m := g.metric
+		m.Value = &value
+		res = append(res, m)
+	}
+	for _, t := range timers {
+		m := t.metric
+		m.Summary = t.summary
+		res = append(res, m)
+	}
+
+	for i, m := range res {
+		err := s.service.SaveMetrics([]metrics.Metric{m})
+		if err != nil && !errors.Is(err, repository.ErrParseMetric) {
+			s.logger.Error().Err(err).Int("metrics", len(res)-i).Msg("Failed to store StatsD metrics, they are kept for the next flush")
+			break
+		}
+		if err != nil {
+			s.logger.Warn().Err(err).Str("name", m.Key()).Msg("Invalid StatsD metric is dropped")
+		}
+		// stored or dropped
+		switch m.MType {
+		case metrics.TypeCounter:
+			counters[m.Key()].value -= float64(*m.Delta)
+		case metrics.TypeGauge:
+			delete(gauges, m.Key())
+		case metrics.TypeSummary:
+			delete(timers, m.Key())
+		}
+	}
+
+	s.requeue(counters, gauges, timers)
+}
+
+// requeue adds the aggregates left by a flush to the current interval, the
+// gauges received since then are newer and win.
+func (s *Listener) requeue(counters map[string]*counter, gauges map[string]*gauge, timers map[string]*timer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, c := range counters {
+		if c.value == 0 {
+			continue
+		}
+		if current, ok := s.counters[key]; ok {
+			current.value += c.value
+		} else {
+			s.counters[key] = c
+		}
+	}
+	for key, g := range gauges {
+		if _, ok := s.gauges[key]; !ok {
+			s.gauges[key] = g
+		}
+	}
+	for key, t := range timers {
+		if current, ok := s.timers[key]; ok {
+			t.summary.Merge(current.summary)
+		}
+		s.timers[key] = t
+	}
+}
@@ -0,0 +1,82 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidLine = errors.New("invalid statsd line")
+
+// Types of the StatsD lines the listener aggregates.
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+	typeTimer   = "ms"
+)
+
+// Line is a single StatsD update, e.g. api.requests:1|c|@0.1|#host:web1.
+type Line struct {
+	Name  string
+	Value float64
+	Type  string
+	// Rate is the sample rate of counters, the counter was incremented
+	// Value/Rate times for every update received.
+	Rate float64
+	// Relative is set for gauges sent with an explicit sign, which change the
+	// current value instead of replacing it.
+	Relative bool
+	// Labels are parsed from the DogStatsD tags.
+	Labels map[string]string
+}
+
+// ParseLine parses name:value|type[|@rate][|#tag:value,...].
+func ParseLine(s string) (*Line, error) {
+	name, rest, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return nil, fmt.Errorf("%w: %q has no name", ErrInvalidLine, s)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("%w: %q has no type", ErrInvalidLine, s)
+	}
+
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: %q has an invalid value", ErrInvalidLine, s)
+	}
+	l := Line{Name: name, Value: value, Type: parts[1], Rate: 1}
+	switch l.Type {
+	case typeCounter, typeTimer:
+	case typeGauge:
+		l.Relative = strings.HasPrefix(parts[0], "+") || strings.HasPrefix(parts[0], "-")
+	default:
+		return nil, fmt.Errorf("%w: %q has unsupported type %q", ErrInvalidLine, s, l.Type)
+	}
+
+	for _, p := range parts[2:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("%w: %q has an invalid sample rate", ErrInvalidLine, s)
+			}
+			l.Rate = rate
+		case strings.HasPrefix(p, "#"):
+			for _, tag := range strings.Split(p[1:], ",") {
+				k, v, _ := strings.Cut(tag, ":")
+				if k = strings.TrimSpace(k); k == "" {
+					continue
+				}
+				if l.Labels == nil {
+					l.Labels = make(map[string]string)
+				}
+				l.Labels[k] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return &l, nil
+}
@@ -2,9 +2,13 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/DieOfCode/go-alert-service/internal/series"
 	"github.com/rs/zerolog"
 )
 
@@ -25,7 +29,7 @@ func NewDatabaseStorage(logger *zerolog.Logger, db *sql.DB) *DatabaseStorage {
 
 func (storage *DatabaseStorage) LoadAll() metrics.Data {
 
-	rows, err := storage.db.Query("SELECT id,type,value,delta FROM metrics")
+	rows, err := storage.db.Query(selectMetrics)
 	if err != nil {
 		return nil
 	}
@@ -33,31 +37,16 @@ func (storage *DatabaseStorage) LoadAll() metrics.Data {
 
 	result := make(metrics.Data)
 	for rows.Next() {
-		var mID, mType string
-		var mValue sql.NullFloat64
-		var mDelta sql.NullInt64
-
-		if err := rows.Scan(&mID, &mType, &mValue, &mDelta); err != nil {
+		m, err := scanMetric(rows)
+		if err != nil {
 			return nil
 		}
-		_, ok := result[mType]
+		_, ok := result[m.MType]
 		if !ok {
-			result[mType] = map[string]metrics.Metric{
-				mID: {
-					ID:    mID,
-					MType: mType,
-					Delta: parseDelta(mDelta),
-					Value: parseValue(mValue),
-				},
-			}
+			result[m.MType] = map[string]metrics.Metric{m.Key(): *m}
 			continue
 		}
-		result[mType][mID] = metrics.Metric{
-			ID:    mID,
-			MType: mType,
-			Delta: parseDelta(mDelta),
-			Value: parseValue(mValue),
-		}
+		result[m.MType][m.Key()] = *m
 	}
 	if err := rows.Err(); err != nil {
 		return nil
@@ -77,21 +66,76 @@ func (storage *DatabaseStorage) StoreMetrics(metrics []metrics.Metric) error {
 	return nil
 }
 
-func (storage *DatabaseStorage) Load(mtype, mname string) *metrics.Metric {
+func (storage *DatabaseStorage) Load(mtype, mname string, labels map[string]string) (*metrics.Metric, error) {
+	row := storage.db.QueryRow(selectMetrics+" WHERE type = $1 AND id = $2 AND labels = $3::jsonb", mtype, mname, encodeLabels(labels))
+	m, err := scanMetric(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	return m, err
+}
+
+const selectMetrics = "SELECT id, type, value, delta, labels, histogram, summary, hll FROM metrics"
+
+func scanMetric(row interface{ Scan(dest ...any) error }) (*metrics.Metric, error) {
 	var mID, mType string
 	var mValue sql.NullFloat64
 	var mDelta sql.NullInt64
+	var mLabels, mHistogram, mSummary, mSet []byte
 
-	row := storage.db.QueryRow("SELECT id, type, value, delta FROM metrics WHERE type = $1 AND id = $2", mtype, mname)
-	if err := row.Scan(&mID, &mType, &mValue, &mDelta); err != nil {
-		return nil
+	if err := row.Scan(&mID, &mType, &mValue, &mDelta, &mLabels, &mHistogram, &mSummary, &mSet); err != nil {
+		return nil, err
+	}
+	labels, err := decodeLabels(mLabels)
+	if err != nil {
+		return nil, err
+	}
+	histogram, err := parseJSON[metrics.Histogram](mHistogram)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := parseJSON[metrics.Summary](mSummary)
+	if err != nil {
+		return nil, err
+	}
+	set, err := parseJSON[metrics.Set](mSet)
+	if err != nil {
+		return nil, err
 	}
 	return &metrics.Metric{
-		MType: mType,
-		ID:    mID,
-		Value: parseValue(mValue),
-		Delta: parseDelta(mDelta),
+		ID:        mID,
+		MType:     mType,
+		Delta:     parseDelta(mDelta),
+		Value:     parseValue(mValue),
+		Histogram: histogram,
+		Summary:   summary,
+		Set:       set,
+		Labels:    labels,
+	}, nil
+}
+
+// encodeLabels returns the labels as a JSON object for the labels columns.
+func encodeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	b, err := json.Marshal(labels)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// decodeLabels parses a labels column, an empty object gives nil labels.
+func decodeLabels(b []byte) (map[string]string, error) {
+	var labels map[string]string
+	if err := json.Unmarshal(b, &labels); err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, nil
 	}
+	return labels, nil
 }
 
 func parseDelta(mDelta sql.NullInt64) *int64 {
@@ -108,26 +152,58 @@ func parseValue(mValue sql.NullFloat64) *float64 {
 	return nil
 }
 
+// parseJSON decodes a nullable JSONB column, NULL gives nil.
+func parseJSON[T any](b []byte) (*T, error) {
+	if b == nil {
+		return nil, nil
+	}
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
 func (storage *DatabaseStorage) Store(m metrics.Metric) error {
+	switch m.MType {
+	case metrics.TypeHistogram:
+		return storage.storeHistogram(m)
+	case metrics.TypeSummary:
+		return storage.storeSummary(m)
+	case metrics.TypeSet:
+		return storage.storeSet(m)
+	}
+
 	var query string
 	var args []interface{}
 
+	// the new value of the series is recorded as a sample in the same statement
 	if m.MType == metrics.TypeCounter {
 		query = `
-            INSERT INTO metrics (id, type, delta) VALUES ($1, $2, $3)
-            ON CONFLICT (id, type) DO UPDATE
-            SET delta = metrics.delta + EXCLUDED.delta
-            WHERE metrics.type = 'counter'
+            WITH stored AS (
+                INSERT INTO metrics (id, type, delta, labels) VALUES ($1, $2, $3, $5::jsonb)
+                ON CONFLICT (id, type, labels) DO UPDATE
+                SET delta = metrics.delta + EXCLUDED.delta
+                WHERE metrics.type = 'counter'
+                RETURNING id, type, delta, labels
+            )
+            INSERT INTO samples (id, type, time, value, labels)
+            SELECT id, type::text, $4, delta, labels FROM stored
         `
-		args = append(args, m.ID, m.MType, *m.Delta)
+		args = append(args, m.ID, m.MType, *m.Delta, time.Now(), encodeLabels(m.Labels))
 	} else if m.MType == metrics.TypeGauge {
 		query = `
-            INSERT INTO metrics (id, type, value) VALUES ($1, $2, $3)
-            ON CONFLICT (id, type) DO UPDATE
-            SET value = EXCLUDED.value
-            WHERE metrics.type = 'gauge'
+            WITH stored AS (
+                INSERT INTO metrics (id, type, value, labels) VALUES ($1, $2, $3, $5::jsonb)
+                ON CONFLICT (id, type, labels) DO UPDATE
+                SET value = EXCLUDED.value
+                WHERE metrics.type = 'gauge'
+                RETURNING id, type, value, labels
+            )
+            INSERT INTO samples (id, type, time, value, labels)
+            SELECT id, type::text, $4, value, labels FROM stored
         `
-		args = append(args, m.ID, m.MType, *m.Value)
+		args = append(args, m.ID, m.MType, *m.Value, time.Now(), encodeLabels(m.Labels))
 	}
 
 	_, err := storage.db.Exec(query, args...)
@@ -135,6 +211,125 @@ func (storage *DatabaseStorage) Store(m metrics.Metric) error {
 	return err
 }
 
+func (storage *DatabaseStorage) storeHistogram(m metrics.Metric) error {
+	return storage.storeMerged(m, "histogram", func(b []byte) (any, float64, error) {
+		stored, err := parseJSON[metrics.Histogram](b)
+		if err != nil {
+			return nil, 0, err
+		}
+		h, err := mergeHistogram(stored, m.Histogram)
+		if err != nil {
+			return nil, 0, err
+		}
+		return h, float64(h.Count), nil
+	})
+}
+
+func (storage *DatabaseStorage) storeSummary(m metrics.Metric) error {
+	return storage.storeMerged(m, "summary", func(b []byte) (any, float64, error) {
+		stored, err := parseJSON[metrics.Summary](b)
+		if err != nil {
+			return nil, 0, err
+		}
+		summary, err := mergeSummary(stored, m)
+		if err != nil {
+			return nil, 0, err
+		}
+		return summary, float64(summary.Count), nil
+	})
+}
+
+func (storage *DatabaseStorage) storeSet(m metrics.Metric) error {
+	return storage.storeMerged(m, "hll", func(b []byte) (any, float64, error) {
+		stored, err := parseJSON[metrics.Set](b)
+		if err != nil {
+			return nil, 0, err
+		}
+		set, err := mergeSet(stored, m)
+		if err != nil {
+			return nil, 0, err
+		}
+		return set, float64(set.Estimate()), nil
+	})
+}
+
+// storeMerged updates a series kept as JSON in the column. The stored value is locked and merged with the update in a
+// transaction since it can't be added up in a single statement like counters. The row of a new series is inserted
+// first, so concurrent first updates wait for the lock instead of both merging from nothing.
+// merge returns the new value and the sample recorded for it.
+func (storage *DatabaseStorage) storeMerged(m metrics.Metric, column string, merge func(stored []byte) (any, float64, error)) error {
+	tx, err := storage.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	labels := encodeLabels(m.Labels)
+	if _, err := tx.Exec(`
+        INSERT INTO metrics (id, type, labels) VALUES ($1, $2, $3::jsonb)
+        ON CONFLICT (id, type, labels) DO NOTHING
+    `, m.ID, m.MType, labels); err != nil {
+		return err
+	}
+	var stored []byte
+	err = tx.QueryRow(`
+        SELECT `+column+` FROM metrics
+        WHERE type = $1 AND id = $2 AND labels = $3::jsonb
+        FOR UPDATE
+    `, m.MType, m.ID, labels).Scan(&stored)
+	if err != nil {
+		return err
+	}
+	merged, sample, err := merge(stored)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`
+        UPDATE metrics SET `+column+` = $4::jsonb
+        WHERE type = $1 AND id = $2 AND labels = $3::jsonb
+    `, m.MType, m.ID, labels, string(b)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+        INSERT INTO samples (id, type, time, value, labels) VALUES ($1, $2, $3, $4, $5::jsonb)
+    `, m.ID, m.MType, time.Now(), sample, labels); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (storage *DatabaseStorage) LoadSamples(mtype, mname string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error) {
+	rows, err := storage.db.Query(`
+        SELECT time, value FROM samples
+        WHERE type = $1 AND id = $2 AND labels = $5::jsonb AND time >= $3 AND time < $4
+        ORDER BY time
+    `, mtype, mname, from, to, encodeLabels(labels))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []metrics.Sample
+	for rows.Next() {
+		var s metrics.Sample
+		if err := rows.Scan(&s.Time, &s.Value); err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
 func (storage *DatabaseStorage) RestoreFromFile() error {
 	return errNotSupported
 }
@@ -142,3 +337,400 @@ func (storage *DatabaseStorage) RestoreFromFile() error {
 func (storage *DatabaseStorage) WriteToFile() error {
 	return errNotSupported
 }
+
+func (storage *DatabaseStorage) LoadAlerts() ([]metrics.Alert, error) {
+	rows, err := storage.db.Query(`
+        SELECT rule_id, state, value, active_at, fired_at, resolved_at, updated_at,
+               acknowledged_by, acknowledged_at, notified_at
+        FROM alerts
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []metrics.Alert
+	for rows.Next() {
+		var a metrics.Alert
+		var activeAt, firedAt, resolvedAt, acknowledgedAt, notifiedAt sql.NullTime
+
+		if err := rows.Scan(&a.RuleID, &a.State, &a.Value, &activeAt, &firedAt, &resolvedAt, &a.UpdatedAt,
+			&a.AcknowledgedBy, &acknowledgedAt, &notifiedAt); err != nil {
+			return nil, err
+		}
+		a.ActiveAt = parseTime(activeAt)
+		a.FiredAt = parseTime(firedAt)
+		a.ResolvedAt = parseTime(resolvedAt)
+		a.AcknowledgedAt = parseTime(acknowledgedAt)
+		a.NotifiedAt = parseTime(notifiedAt)
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+func (storage *DatabaseStorage) StoreAlert(a metrics.Alert) error {
+	_, err := storage.db.Exec(`
+        INSERT INTO alerts (rule_id, state, value, active_at, fired_at, resolved_at, updated_at,
+                            acknowledged_by, acknowledged_at, notified_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+        ON CONFLICT (rule_id) DO UPDATE
+        SET state = EXCLUDED.state,
+            value = EXCLUDED.value,
+            active_at = EXCLUDED.active_at,
+            fired_at = EXCLUDED.fired_at,
+            resolved_at = EXCLUDED.resolved_at,
+            updated_at = EXCLUDED.updated_at,
+            acknowledged_by = EXCLUDED.acknowledged_by,
+            acknowledged_at = EXCLUDED.acknowledged_at,
+            notified_at = EXCLUDED.notified_at
+    `, a.RuleID, a.State, a.Value, a.ActiveAt, a.FiredAt, a.ResolvedAt, a.UpdatedAt,
+		a.AcknowledgedBy, a.AcknowledgedAt, a.NotifiedAt)
+
+	return err
+}
+
+func (storage *DatabaseStorage) DeleteAlert(ruleID string) error {
+	_, err := storage.db.Exec(`DELETE FROM alerts WHERE rule_id = $1`, ruleID)
+	return err
+}
+
+func parseTime(t sql.NullTime) *time.Time {
+	if t.Valid {
+		return &t.Time
+	}
+	return nil
+}
+
+const selectRules = "SELECT id, name, type, metric, labels, condition, threshold, for_seconds, hysteresis, disabled FROM rules"
+
+func scanRule(row interface{ Scan(dest ...any) error }) (*metrics.AlertRule, error) {
+	var r metrics.AlertRule
+	var labels []byte
+	if err := row.Scan(&r.ID, &r.Name, &r.MType, &r.MName, &labels, &r.Condition, &r.Threshold, &r.For, &r.Hysteresis, &r.Disabled); err != nil {
+		return nil, err
+	}
+	var err error
+	if r.Labels, err = decodeLabels(labels); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (storage *DatabaseStorage) LoadRules() ([]metrics.AlertRule, error) {
+	rows, err := storage.db.Query(selectRules + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []metrics.AlertRule
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (storage *DatabaseStorage) LoadRule(id string) (*metrics.AlertRule, error) {
+	r, err := scanRule(storage.db.QueryRow(selectRules+" WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	return r, err
+}
+
+func (storage *DatabaseStorage) StoreRule(r metrics.AlertRule) error {
+	_, err := storage.db.Exec(`
+        INSERT INTO rules (id, name, type, metric, condition, threshold, for_seconds, hysteresis, disabled, labels)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::jsonb)
+        ON CONFLICT (id) DO UPDATE
+        SET name = EXCLUDED.name,
+            type = EXCLUDED.type,
+            metric = EXCLUDED.metric,
+            labels = EXCLUDED.labels,
+            condition = EXCLUDED.condition,
+            threshold = EXCLUDED.threshold,
+            for_seconds = EXCLUDED.for_seconds,
+            hysteresis = EXCLUDED.hysteresis,
+            disabled = EXCLUDED.disabled
+    `, r.ID, r.Name, r.MType, r.MName, r.Condition, r.Threshold, r.For, r.Hysteresis, r.Disabled, encodeLabels(r.Labels))
+
+	return err
+}
+
+func (storage *DatabaseStorage) DeleteRule(id string) error {
+	res, err := storage.db.Exec("DELETE FROM rules WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+const selectDeliveries = "SELECT id, notifier, notification, status, attempts, last_error, next_attempt, created_at, updated_at FROM deliveries"
+
+func scanDelivery(row interface{ Scan(dest ...any) error }) (*metrics.Delivery, error) {
+	var d metrics.Delivery
+	var notification []byte
+	if err := row.Scan(&d.ID, &d.Notifier, &notification, &d.Status, &d.Attempts, &d.LastError, &d.NextAttempt, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(notification, &d.Notification); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (storage *DatabaseStorage) LoadDeliveries(status string) ([]metrics.Delivery, error) {
+	rows, err := storage.db.Query(selectDeliveries+" WHERE $1 = '' OR status = $1 ORDER BY created_at", status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []metrics.Delivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (storage *DatabaseStorage) LoadDelivery(id string) (*metrics.Delivery, error) {
+	d, err := scanDelivery(storage.db.QueryRow(selectDeliveries+" WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	return d, err
+}
+
+func (storage *DatabaseStorage) StoreDelivery(d metrics.Delivery) error {
+	notification, err := json.Marshal(d.Notification)
+	if err != nil {
+		return err
+	}
+
+	_, err = storage.db.Exec(`
+        INSERT INTO deliveries (id, notifier, notification, status, attempts, last_error, next_attempt, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (id) DO UPDATE
+        SET status = EXCLUDED.status,
+            attempts = EXCLUDED.attempts,
+            last_error = EXCLUDED.last_error,
+            next_attempt = EXCLUDED.next_attempt,
+            updated_at = EXCLUDED.updated_at
+    `, d.ID, d.Notifier, notification, d.Status, d.Attempts, d.LastError, d.NextAttempt, d.CreatedAt, d.UpdatedAt)
+
+	return err
+}
+
+func (storage *DatabaseStorage) DeleteDeliveries(before time.Time) error {
+	_, err := storage.db.Exec("DELETE FROM deliveries WHERE status <> 'pending' AND updated_at < $1", before)
+
+	return err
+}
+
+const selectSilences = "SELECT id, metric, type, host, starts_at, ends_at, comment, created_by, created_at FROM silences"
+
+func scanSilence(row interface{ Scan(dest ...any) error }) (*metrics.Silence, error) {
+	var s metrics.Silence
+	if err := row.Scan(&s.ID, &s.Metric, &s.MType, &s.Host, &s.StartsAt, &s.EndsAt, &s.Comment, &s.CreatedBy, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (storage *DatabaseStorage) LoadSilences() ([]metrics.Silence, error) {
+	rows, err := storage.db.Query(selectSilences + " ORDER BY starts_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var silences []metrics.Silence
+	for rows.Next() {
+		s, err := scanSilence(rows)
+		if err != nil {
+			return nil, err
+		}
+		silences = append(silences, *s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return silences, nil
+}
+
+func (storage *DatabaseStorage) LoadSilence(id string) (*metrics.Silence, error) {
+	s, err := scanSilence(storage.db.QueryRow(selectSilences+" WHERE id = $1", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrNotFound
+	}
+	return s, err
+}
+
+func (storage *DatabaseStorage) StoreSilence(s metrics.Silence) error {
+	_, err := storage.db.Exec(`
+        INSERT INTO silences (id, metric, type, host, starts_at, ends_at, comment, created_by, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (id) DO UPDATE
+        SET metric = EXCLUDED.metric,
+            type = EXCLUDED.type,
+            host = EXCLUDED.host,
+            starts_at = EXCLUDED.starts_at,
+            ends_at = EXCLUDED.ends_at,
+            comment = EXCLUDED.comment,
+            created_by = EXCLUDED.created_by
+    `, s.ID, s.Metric, s.MType, s.Host, s.StartsAt, s.EndsAt, s.Comment, s.CreatedBy, s.CreatedAt)
+
+	return err
+}
+
+func (storage *DatabaseStorage) DeleteSilence(id string) error {
+	res, err := storage.db.Exec("DELETE FROM silences WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (storage *DatabaseStorage) AppendEvent(e metrics.AlertEvent) error {
+	_, err := storage.db.Exec(`
+        INSERT INTO alert_history (rule_id, kind, state, value, actor, comment, notifier, time)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `, e.RuleID, e.Kind, e.State, e.Value, e.Actor, e.Comment, e.Notifier, e.Time)
+
+	return err
+}
+
+func (storage *DatabaseStorage) LoadEvents(ruleID string, from, to time.Time) ([]metrics.AlertEvent, error) {
+	rows, err := storage.db.Query(`
+        SELECT id, rule_id, kind, state, value, actor, comment, notifier, time
+        FROM alert_history
+        WHERE ($1 = '' OR rule_id = $1) AND time >= $2 AND time < $3
+        ORDER BY time, id
+    `, ruleID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []metrics.AlertEvent
+	for rows.Next() {
+		var e metrics.AlertEvent
+		if err := rows.Scan(&e.ID, &e.RuleID, &e.Kind, &e.State, &e.Value, &e.Actor, &e.Comment, &e.Notifier, &e.Time); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (storage *DatabaseStorage) Rollup(resolution, source time.Duration, from, to time.Time) error {
+	query := `
+        INSERT INTO rollups (resolution, type, id, labels, time, min, max, sum, count, last)
+        SELECT $1, type, id, labels, to_timestamp(floor(extract(epoch FROM time) / $1) * $1) AS bucket,
+               min(value), max(value), sum(value), count(*), (array_agg(value ORDER BY time DESC))[1]
+        FROM samples
+        WHERE time >= $2 AND time < $3
+        GROUP BY type, id, labels, bucket
+    `
+	args := []any{int64(resolution.Seconds()), from, to}
+	if source != series.Raw {
+		query = `
+            INSERT INTO rollups (resolution, type, id, labels, time, min, max, sum, count, last)
+            SELECT $1, type, id, labels, to_timestamp(floor(extract(epoch FROM time) / $1) * $1) AS bucket,
+                   min(min), max(max), sum(sum), sum(count), (array_agg(last ORDER BY time DESC))[1]
+            FROM rollups
+            WHERE resolution = $4 AND time >= $2 AND time < $3
+            GROUP BY type, id, labels, bucket
+        `
+		args = append(args, int64(source.Seconds()))
+	}
+	query += `
+        ON CONFLICT (resolution, type, id, labels, time) DO UPDATE
+        SET min = EXCLUDED.min,
+            max = EXCLUDED.max,
+            sum = EXCLUDED.sum,
+            count = EXCLUDED.count,
+            last = EXCLUDED.last
+    `
+
+	_, err := storage.db.Exec(query, args...)
+
+	return err
+}
+
+func (storage *DatabaseStorage) LoadRollups(mtype, mname string, labels map[string]string, resolution time.Duration, from, to time.Time) ([]metrics.Rollup, error) {
+	rows, err := storage.db.Query(`
+        SELECT time, min, max, sum, count, last FROM rollups
+        WHERE resolution = $1 AND type = $2 AND id = $3 AND labels = $6::jsonb AND time >= $4 AND time < $5
+        ORDER BY time
+    `, int64(resolution.Seconds()), mtype, mname, from, to, encodeLabels(labels))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []metrics.Rollup
+	for rows.Next() {
+		var r metrics.Rollup
+		if err := rows.Scan(&r.Time, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rollups, nil
+}
+
+func (storage *DatabaseStorage) DeleteSamples(before time.Time) error {
+	_, err := storage.db.Exec("DELETE FROM samples WHERE time < $1", before)
+
+	return err
+}
+
+func (storage *DatabaseStorage) DeleteRollups(resolution time.Duration, before time.Time) error {
+	_, err := storage.db.Exec("DELETE FROM rollups WHERE resolution = $1 AND time < $2", int64(resolution.Seconds()), before)
+
+	return err
+}
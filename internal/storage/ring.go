@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/DieOfCode/go-alert-service/internal/metrics"
+)
+
+// ring is a bounded buffer of samples that overwrites the oldest sample
+// once it is full. Samples are expected to be pushed in time order.
+type ring struct {
+	samples []metrics.Sample
+	start   int
+	size    int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{samples: make([]metrics.Sample, capacity)}
+}
+
+func (r *ring) push(s metrics.Sample) {
+	if len(r.samples) == 0 {
+		return
+	}
+	end := (r.start + r.size) % len(r.samples)
+	r.samples[end] = s
+	if r.size < len(r.samples) {
+		r.size++
+		return
+	}
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// all returns the samples from the oldest to the newest.
+func (r *ring) all() []metrics.Sample {
+	res := make([]metrics.Sample, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		res = append(res, r.samples[(r.start+i)%len(r.samples)])
+	}
+	return res
+}
+
+// between returns the samples in [from, to).
+func (r *ring) between(from, to time.Time) []metrics.Sample {
+	var res []metrics.Sample
+	for _, s := range r.all() {
+		if s.Time.Before(from) || !s.Time.Before(to) {
+			continue
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// dropBefore removes the samples older than t.
+func (r *ring) dropBefore(t time.Time) {
+	for r.size > 0 && r.samples[r.start].Time.Before(t) {
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// resize changes the capacity keeping the newest samples, a capacity below 1
+// drops them all.
+func (r *ring) resize(capacity int) {
+	if capacity <= 0 {
+		r.samples = nil
+		r.start = 0
+		r.size = 0
+		return
+	}
+	samples := r.all()
+	if len(samples) > capacity {
+		samples = samples[len(samples)-capacity:]
+	}
+	r.samples = make([]metrics.Sample, capacity)
+	r.start = 0
+	r.size = copy(r.samples, samples)
+}
+
+func (r *ring) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.all())
+}
+
+func (r *ring) UnmarshalJSON(b []byte) error {
+	var samples []metrics.Sample
+	if err := json.Unmarshal(b, &samples); err != nil {
+		return err
+	}
+	r.samples = samples
+	r.start = 0
+	r.size = len(samples)
+	return nil
+}
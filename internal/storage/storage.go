@@ -3,10 +3,15 @@ package storage
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/DieOfCode/go-alert-service/internal/metrics"
+	"github.com/DieOfCode/go-alert-service/internal/repository"
+	"github.com/DieOfCode/go-alert-service/internal/series"
 	"github.com/rs/zerolog"
 )
 
@@ -14,16 +19,47 @@ type MemStorage struct {
 	mu              sync.RWMutex
 	logger          *zerolog.Logger
 	data            metrics.Data
+	alerts          map[string]metrics.Alert
+	rules           map[string]metrics.AlertRule
+	deliveries      map[string]metrics.Delivery
+	silences        map[string]metrics.Silence
+	history         []metrics.AlertEvent
+	samples         map[string]map[string]*ring
+	samplesLimit    int
+	historyLimit    int
+	rollups         map[time.Duration]map[string]map[string][]metrics.Rollup
 	interval        int
 	storageFileName string
 }
 
-func NewMemStorage(logger *zerolog.Logger, interval int, file string) *MemStorage {
+// snapshot is the content of the storage file.
+type snapshot struct {
+	Metrics    metrics.Data                                             `json:"metrics"`
+	Alerts     map[string]metrics.Alert                                 `json:"alerts,omitempty"`
+	Rules      map[string]metrics.AlertRule                             `json:"rules,omitempty"`
+	Deliveries map[string]metrics.Delivery                              `json:"deliveries,omitempty"`
+	Silences   map[string]metrics.Silence                               `json:"silences,omitempty"`
+	History    []metrics.AlertEvent                                     `json:"history,omitempty"`
+	Samples    map[string]map[string]*ring                              `json:"samples,omitempty"`
+	Rollups    map[time.Duration]map[string]map[string][]metrics.Rollup `json:"rollups,omitempty"`
+}
+
+// NewMemStorage creates a storage that keeps up to samplesLimit latest samples of every series
+// and the historyLimit latest alert events, a historyLimit of 0 keeps all of them.
+func NewMemStorage(logger *zerolog.Logger, interval int, file string, samplesLimit, historyLimit int) *MemStorage {
 	return &MemStorage{
 		logger:          logger,
 		interval:        interval,
 		storageFileName: file,
+		samplesLimit:    samplesLimit,
+		historyLimit:    historyLimit,
+		samples:         make(map[string]map[string]*ring),
+		rollups:         make(map[time.Duration]map[string]map[string][]metrics.Rollup),
 		data:            make(metrics.Data),
+		alerts:          make(map[string]metrics.Alert),
+		rules:           make(map[string]metrics.AlertRule),
+		deliveries:      make(map[string]metrics.Delivery),
+		silences:        make(map[string]metrics.Silence),
 	}
 }
 
@@ -40,14 +76,58 @@ func (s *MemStorage) RestoreFromFile() error {
 		return err
 	}
 
-	if err := json.Unmarshal(b, &s.data); err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
 		return err
 	}
+	if snap.Metrics == nil {
+		// files written before the snapshot format contain the metrics only
+		if err := json.Unmarshal(b, &s.data); err != nil {
+			return err
+		}
+	} else {
+		s.data = snap.Metrics
+	}
+	if snap.Alerts != nil {
+		s.alerts = snap.Alerts
+	}
+	if snap.Rules != nil {
+		s.rules = snap.Rules
+	}
+	if snap.Deliveries != nil {
+		s.deliveries = snap.Deliveries
+	}
+	if snap.Silences != nil {
+		s.silences = snap.Silences
+	}
+	s.history = snap.History
+	s.trimHistory()
+	for _, series := range snap.Samples {
+		for _, r := range series {
+			r.resize(s.samplesLimit)
+		}
+	}
+	if snap.Samples != nil {
+		s.samples = snap.Samples
+	}
+	if snap.Rollups != nil {
+		s.rollups = snap.Rollups
+	}
 	s.logger.Info().Msgf("RestoreFromFile: %+v", s.data)
 	return nil
 }
 
 func (s *MemStorage) WriteToFile() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.writeToFile()
+}
+
+// writeToFile expects the caller to hold the lock.
+func (s *MemStorage) writeToFile() error {
 	file, err := os.OpenFile(s.storageFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
@@ -55,11 +135,20 @@ func (s *MemStorage) WriteToFile() error {
 	defer file.Close()
 	s.logger.Info().Msg("File successfully opened")
 
-	b, err := json.MarshalIndent(s.data, "", "  ")
+	b, err := json.MarshalIndent(snapshot{
+		Metrics:    s.data,
+		Alerts:     s.alerts,
+		Rules:      s.rules,
+		Deliveries: s.deliveries,
+		Silences:   s.silences,
+		History:    s.history,
+		Samples:    s.samples,
+		Rollups:    s.rollups,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
-	s.logger.Info().Msgf("Data successfully marshalled: %v", string(b))
+	s.logger.Info().Msgf("Data successfully marshalled: %d bytes", len(b))
 
 	n, err := file.Write(b)
 	if err != nil {
@@ -69,39 +158,51 @@ func (s *MemStorage) WriteToFile() error {
 	return nil
 }
 
+// LoadAll returns a copy of the metrics, the stored ones keep changing while
+// the caller reads it.
 func (s *MemStorage) LoadAll() metrics.Data {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.data
+
+	data := make(metrics.Data, len(s.data))
+	for mtype, series := range s.data {
+		data[mtype] = make(map[string]metrics.Metric, len(series))
+		for key, m := range series {
+			data[mtype][key] = m.Clone()
+		}
+	}
+	return data
 }
 
-func (s *MemStorage) Load(mtype, mname string) *metrics.Metric {
+func (s *MemStorage) Load(mtype, mname string, labels map[string]string) (*metrics.Metric, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	key := metrics.SeriesKey(mname, labels)
 	metrics, ok := s.data[mtype]
 	if !ok {
 		s.logger.Info().Msgf("Metric type %s doesn't exist", mtype)
-		return nil
+		return nil, repository.ErrNotFound
 	}
 
-	mvalue, ok := metrics[mname]
+	mvalue, ok := metrics[key]
 	if !ok {
-		s.logger.Info().Msgf("Metric %v doesn't exist", mvalue)
-		return nil
+		s.logger.Info().Msgf("Metric %v doesn't exist", key)
+		return nil, repository.ErrNotFound
 	}
 
-	return &mvalue
+	mvalue = mvalue.Clone()
+	return &mvalue, nil
 }
 
 func (s *MemStorage) Store(m metrics.Metric) error {
-	s.logger.Info().Interface("Start store", s.data).Send()
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.logger.Info().Interface("Start store", s.data).Send()
 
 	if s.interval == 0 {
 		defer func() {
-			if err := s.WriteToFile(); err != nil {
+			if err := s.writeToFile(); err != nil {
 				s.logger.Error().Err(err).Msg("Failed to write storage content to file")
 
 			}
@@ -111,29 +212,261 @@ func (s *MemStorage) Store(m metrics.Metric) error {
 
 	metric, ok := s.data[m.MType]
 	if !ok {
-		s.data[m.MType] = map[string]metrics.Metric{
-			m.ID: {ID: m.ID, MType: m.MType, Value: m.Value, Delta: m.Delta},
-		}
-		return nil
+		metric = make(map[string]metrics.Metric)
+		s.data[m.MType] = metric
 	}
 
+	key := m.Key()
 	switch m.MType {
 	case metrics.TypeGauge:
-		metric[m.ID] = metrics.Metric{ID: m.ID, MType: m.MType, Value: m.Value}
+		metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Value: m.Value, Labels: m.Labels}
 	case metrics.TypeCounter:
-		selectedMetric, ok := metric[m.ID]
+		selectedMetric, ok := metric[key]
 		if !ok {
-			metric[m.ID] = metrics.Metric{ID: m.ID, MType: m.MType, Delta: m.Delta}
-			return nil
+			metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Delta: m.Delta, Labels: m.Labels}
+			break
 		}
 		*selectedMetric.Delta += *m.Delta
-		metric[m.ID] = metrics.Metric{ID: m.ID, MType: m.MType, Delta: selectedMetric.Delta}
+		metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Delta: selectedMetric.Delta, Labels: m.Labels}
+	case metrics.TypeHistogram:
+		var stored *metrics.Histogram
+		if selectedMetric, ok := metric[key]; ok {
+			stored = selectedMetric.Histogram
+		}
+		h, err := mergeHistogram(stored, m.Histogram)
+		if err != nil {
+			return err
+		}
+		metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Histogram: h, Labels: m.Labels}
+	case metrics.TypeSummary:
+		var stored *metrics.Summary
+		if selectedMetric, ok := metric[key]; ok {
+			stored = selectedMetric.Summary
+		}
+		summary, err := mergeSummary(stored, m)
+		if err != nil {
+			return err
+		}
+		metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Summary: summary, Labels: m.Labels}
+	case metrics.TypeSet:
+		var stored *metrics.Set
+		if selectedMetric, ok := metric[key]; ok {
+			stored = selectedMetric.Set
+		}
+		set, err := mergeSet(stored, m)
+		if err != nil {
+			return err
+		}
+		metric[key] = metrics.Metric{ID: m.ID, MType: m.MType, Set: set, Labels: m.Labels}
 	}
+	s.appendSample(metric[key], time.Now())
 	s.logger.Info().Interface("Storage content", s.data).Send()
 
 	return nil
 }
 
+// appendSample records the current value of the metric in its series ring
+// buffer. It expects the caller to hold the lock.
+func (s *MemStorage) appendSample(m metrics.Metric, t time.Time) {
+	value, ok := metrics.ValueOf(m)
+	if !ok || s.samplesLimit <= 0 {
+		return
+	}
+
+	series, ok := s.samples[m.MType]
+	if !ok {
+		series = make(map[string]*ring)
+		s.samples[m.MType] = series
+	}
+	r, ok := series[m.Key()]
+	if !ok {
+		r = newRing(s.samplesLimit)
+		series[m.Key()] = r
+	}
+	r.push(metrics.Sample{Time: t, Value: value})
+}
+
+func (s *MemStorage) LoadSamples(mtype, mname string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.samples[mtype][metrics.SeriesKey(mname, labels)]
+	if !ok {
+		return nil, nil
+	}
+	return r.between(from, to), nil
+}
+
+func (s *MemStorage) Rollup(resolution, source time.Duration, from, to time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	computed := make(map[string]map[string][]metrics.Rollup)
+	if source == series.Raw {
+		for mtype, byName := range s.samples {
+			computed[mtype] = make(map[string][]metrics.Rollup)
+			for mname, r := range byName {
+				computed[mtype][mname] = series.Rollup(series.FromSamples(r.between(from, to)), resolution)
+			}
+		}
+	} else {
+		for mtype, byName := range s.rollups[source] {
+			computed[mtype] = make(map[string][]metrics.Rollup)
+			for mname, rollups := range byName {
+				computed[mtype][mname] = series.Rollup(rollupsBetween(rollups, from, to), resolution)
+			}
+		}
+	}
+
+	stored, ok := s.rollups[resolution]
+	if !ok {
+		stored = make(map[string]map[string][]metrics.Rollup)
+		s.rollups[resolution] = stored
+	}
+	for mtype, byName := range computed {
+		if _, ok := stored[mtype]; !ok {
+			stored[mtype] = make(map[string][]metrics.Rollup)
+		}
+		for mname, rollups := range byName {
+			if len(rollups) > 0 {
+				stored[mtype][mname] = upsertRollups(stored[mtype][mname], rollups)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemStorage) LoadRollups(mtype, mname string, labels map[string]string, resolution time.Duration, from, to time.Time) ([]metrics.Rollup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return rollupsBetween(s.rollups[resolution][mtype][metrics.SeriesKey(mname, labels)], from, to), nil
+}
+
+func (s *MemStorage) DeleteSamples(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, byName := range s.samples {
+		for _, r := range byName {
+			r.dropBefore(before)
+		}
+	}
+	return nil
+}
+
+func (s *MemStorage) DeleteRollups(resolution time.Duration, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, byName := range s.rollups[resolution] {
+		for mname, rollups := range byName {
+			i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(before) })
+			byName[mname] = rollups[i:]
+		}
+	}
+	return nil
+}
+
+// rollupsBetween returns the time ordered rollups starting in [from, to).
+func rollupsBetween(rollups []metrics.Rollup, from, to time.Time) []metrics.Rollup {
+	i := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(from) })
+	j := sort.Search(len(rollups), func(i int) bool { return !rollups[i].Time.Before(to) })
+	return append([]metrics.Rollup(nil), rollups[i:j]...)
+}
+
+// upsertRollups merges the time ordered updates into the time ordered
+// rollups, an update replaces the rollup of the same bucket.
+func upsertRollups(rollups, updates []metrics.Rollup) []metrics.Rollup {
+	res := make([]metrics.Rollup, 0, len(rollups)+len(updates))
+	i, j := 0, 0
+	for i < len(rollups) || j < len(updates) {
+		switch {
+		case j == len(updates) || (i < len(rollups) && rollups[i].Time.Before(updates[j].Time)):
+			res = append(res, rollups[i])
+			i++
+		case i < len(rollups) && rollups[i].Time.Equal(updates[j].Time):
+			res = append(res, updates[j])
+			i++
+			j++
+		default:
+			res = append(res, updates[j])
+			j++
+		}
+	}
+	return res
+}
+
+// mergeHistogram validates the update and returns a new histogram with the
+// observations of both, the stored histogram is nil for a new series.
+func mergeHistogram(stored, update *metrics.Histogram) (*metrics.Histogram, error) {
+	if update == nil {
+		return nil, fmt.Errorf("%w: histogram is missing", repository.ErrParseMetric)
+	}
+	h := update.Clone()
+	if err := h.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+	}
+	if stored == nil {
+		return h, nil
+	}
+	merged := stored.Clone()
+	if err := merged.Merge(h); err != nil {
+		return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+	}
+	return merged, nil
+}
+
+// mergeSummary returns a new sketch with the stored observations, the ones
+// of the update sketch and its raw observations.
+func mergeSummary(stored *metrics.Summary, m metrics.Metric) (*metrics.Summary, error) {
+	if m.Summary == nil && len(m.Observations) == 0 {
+		return nil, fmt.Errorf("%w: summary or observations are missing", repository.ErrParseMetric)
+	}
+	summary := metrics.NewSummary()
+	if stored != nil {
+		summary = stored.Clone()
+	}
+	if m.Summary != nil {
+		if err := m.Summary.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+		}
+		if err := summary.Merge(m.Summary); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+		}
+	}
+	for _, v := range m.Observations {
+		if err := summary.Observe(v); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+		}
+	}
+	return summary, nil
+}
+
+// mergeSet returns a new sketch with the stored members, the ones of the
+// update sketch and its Members.
+func mergeSet(stored *metrics.Set, m metrics.Metric) (*metrics.Set, error) {
+	if m.Set == nil && len(m.Members) == 0 {
+		return nil, fmt.Errorf("%w: set or members are missing", repository.ErrParseMetric)
+	}
+	set := metrics.NewSet()
+	if stored != nil {
+		set = stored.Clone()
+	}
+	if m.Set != nil {
+		if err := m.Set.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+		}
+		if err := set.Merge(m.Set); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrParseMetric, err)
+		}
+	}
+	for _, member := range m.Members {
+		set.Add(member)
+	}
+	return set, nil
+}
+
 func (s *MemStorage) StoreMetrics(metrics []metrics.Metric) error {
 
 	for _, metric := range metrics {
@@ -144,3 +477,206 @@ func (s *MemStorage) StoreMetrics(metrics []metrics.Metric) error {
 	}
 	return nil
 }
+
+func (s *MemStorage) LoadAlerts() ([]metrics.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	alerts := make([]metrics.Alert, 0, len(s.alerts))
+	for _, a := range s.alerts {
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
+
+func (s *MemStorage) StoreAlert(a metrics.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts[a.RuleID] = a
+	return s.syncToFile()
+}
+
+func (s *MemStorage) DeleteAlert(ruleID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.alerts, ruleID)
+	return s.syncToFile()
+}
+
+// syncToFile writes the storage content to the file right away when the
+// storage is in synchronous mode. It expects the caller to hold the lock.
+func (s *MemStorage) syncToFile() error {
+	if s.interval == 0 {
+		return s.writeToFile()
+	}
+	return nil
+}
+
+func (s *MemStorage) LoadRules() ([]metrics.AlertRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]metrics.AlertRule, 0, len(s.rules))
+	for _, r := range s.rules {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules, nil
+}
+
+func (s *MemStorage) LoadRule(id string) (*metrics.AlertRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.rules[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &r, nil
+}
+
+func (s *MemStorage) StoreRule(r metrics.AlertRule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules[r.ID] = r
+	return s.syncToFile()
+}
+
+func (s *MemStorage) DeleteRule(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(s.rules, id)
+	return s.syncToFile()
+}
+
+func (s *MemStorage) LoadDeliveries(status string) ([]metrics.Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]metrics.Delivery, 0, len(s.deliveries))
+	for _, d := range s.deliveries {
+		if status == "" || d.Status == status {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt) })
+	return deliveries, nil
+}
+
+func (s *MemStorage) LoadDelivery(id string) (*metrics.Delivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &d, nil
+}
+
+func (s *MemStorage) StoreDelivery(d metrics.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliveries[d.ID] = d
+	return s.syncToFile()
+}
+
+func (s *MemStorage) DeleteDeliveries(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, d := range s.deliveries {
+		if d.Status != metrics.DeliveryPending && d.UpdatedAt.Before(before) {
+			delete(s.deliveries, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemStorage) LoadSilences() ([]metrics.Silence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	silences := make([]metrics.Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		silences = append(silences, silence)
+	}
+	sort.Slice(silences, func(i, j int) bool { return silences[i].StartsAt.Before(silences[j].StartsAt) })
+	return silences, nil
+}
+
+func (s *MemStorage) LoadSilence(id string) (*metrics.Silence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	silence, ok := s.silences[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &silence, nil
+}
+
+func (s *MemStorage) StoreSilence(silence metrics.Silence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.silences[silence.ID] = silence
+	return s.syncToFile()
+}
+
+func (s *MemStorage) DeleteSilence(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.silences[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(s.silences, id)
+	return s.syncToFile()
+}
+
+func (s *MemStorage) AppendEvent(e metrics.AlertEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e.ID = 1
+	if len(s.history) > 0 {
+		e.ID = s.history[len(s.history)-1].ID + 1
+	}
+	s.history = append(s.history, e)
+	s.trimHistory()
+	return s.syncToFile()
+}
+
+// trimHistory drops the oldest events beyond the history limit. It expects
+// the caller to hold the lock.
+func (s *MemStorage) trimHistory() {
+	if s.historyLimit > 0 && len(s.history) > s.historyLimit {
+		s.history = s.history[len(s.history)-s.historyLimit:]
+	}
+}
+
+func (s *MemStorage) LoadEvents(ruleID string, from, to time.Time) ([]metrics.AlertEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []metrics.AlertEvent
+	for _, e := range s.history {
+		if ruleID != "" && e.RuleID != ruleID {
+			continue
+		}
+		if e.Time.Before(from) || !e.Time.Before(to) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}